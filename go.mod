@@ -1,5 +1,5 @@
 module github.com/unixpickle/gobfuscate
 
-go 1.15
+go 1.22
 
 require golang.org/x/tools v0.1.0
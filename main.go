@@ -1,22 +1,33 @@
 package main
 
 import (
-	"crypto/rand"
+	"context"
 	"flag"
 	"fmt"
-	"go/build"
-	"io/ioutil"
 	"log"
+	"math/rand"
 	"os"
-	"os/exec"
+	"strconv"
 	"strings"
+
+	"github.com/unixpickle/gobfuscate/obfuscator"
 )
 
 // Command line arguments.
 var (
 	customPadding       string
+	seed                string
+	policyPath          string
+	planFormat          string
+	stringCipher        string
 	tags                string
+	platforms           string
+	mappingPath         string
+	importMappingPath   string
+	encryptMapping      bool
+	injectTags          bool
 	outputGopath        bool
+	outputModule        bool
 	keepTests           bool
 	winHide             bool
 	noStaticLink        bool
@@ -25,143 +36,195 @@ var (
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "symbolize" {
+		if !symbolize(os.Args[2:]) {
+			os.Exit(1)
+		}
+		return
+	}
+
 	flag.StringVar(&customPadding, "padding", "", "use a custom padding for hashing sensitive information (otherwise a random padding will be used)")
+	flag.StringVar(&seed, "seed", "", "make every random choice (including the padding, if it is not set) from this integer seed, for reproducible builds")
 	flag.BoolVar(&outputGopath, "outdir", false, "output a full GOPATH")
+	flag.BoolVar(&outputModule, "outmod", false, "output a self-contained module with vendored dependencies")
 	flag.BoolVar(&keepTests, "keeptests", false, "keep _test.go files")
 	flag.BoolVar(&winHide, "winhide", false, "hide windows GUI")
 	flag.BoolVar(&noStaticLink, "nostatic", false, "do not statically link")
 	flag.BoolVar(&preservePackageName, "noencrypt", false,
-		"no encrypted package name for go build command (works when main package has CGO code)")
+		"keep the package paths of the targets (and their parent directories)")
 	flag.BoolVar(&verbose, "verbose", false, "verbose mode")
 	flag.StringVar(&tags, "tags", "", "tags are passed to the go compiler")
+	flag.StringVar(&platforms, "platforms", "",
+		"comma-separated GOOS/GOARCH list (with optional +tag suffixes) that the obfuscated code must also build for")
+	flag.StringVar(&mappingPath, "mapping", "", "write a JSON mapping of every renamed package and symbol to this file")
+	flag.StringVar(&importMappingPath, "importmapping", "", "reuse the names from a mapping file written by a previous build")
+	flag.BoolVar(&injectTags, "injecttags", false, "add json/xml/yaml tags to struct fields that reach encoders, so they can be renamed")
+	flag.BoolVar(&encryptMapping, "encryptmapping", false, "encrypt the mapping file with a key derived from the padding")
+	flag.StringVar(&policyPath, "config", "", "read a JSON obfuscation policy from this file (flags take precedence)")
+	flag.StringVar(&stringCipher, "strings", "xor", "encrypt string literals with \"xor\" masks, \"aes\" with per-package keys, or a \"table\" of them per package")
+	flag.StringVar(&planFormat, "plan", "", "print what would be obfuscated as \"text\" or \"json\" without producing any output")
 
 	flag.Parse()
 
-	if len(flag.Args()) != 2 {
+	targets, ok := parseTargets(flag.Args())
+	if !ok {
 		fmt.Fprintln(os.Stderr, "Usage: gobfuscate [flags] pkg_name out_path")
+		fmt.Fprintln(os.Stderr, "       gobfuscate [flags] pkg_name=out_path...")
+		fmt.Fprintln(os.Stderr, "       gobfuscate -plan text|json [flags] pkg_name")
+		fmt.Fprintln(os.Stderr, "       gobfuscate symbolize [flags] mapping_file")
 		flag.PrintDefaults()
 		os.Exit(1)
 	}
 
-	pkgName := flag.Args()[0]
-	outPath := flag.Args()[1]
-
-	if !obfuscate(pkgName, outPath) {
+	if outputGopath && outputModule {
+		fmt.Fprintln(os.Stderr, "The -outdir and -outmod flags cannot be used together.")
 		os.Exit(1)
 	}
-}
 
-func obfuscate(pkgName, outPath string) bool {
-	var newGopath string
-	if outputGopath {
-		newGopath = outPath
-		if err := os.Mkdir(newGopath, 0755); err != nil {
-			fmt.Fprintln(os.Stderr, "Failed to create destination:", err)
-			return false
-		}
-	} else {
-		var err error
-		newGopath, err = ioutil.TempDir("", "")
-		if err != nil {
-			fmt.Fprintln(os.Stderr, "Failed to create temp dir:", err)
-			return false
-		}
-		defer os.RemoveAll(newGopath)
+	if outputGopath && len(targets) > 1 {
+		fmt.Fprintln(os.Stderr, "The -outdir flag can only be used with a single package.")
+		os.Exit(1)
 	}
 
-	log.Println("Copying GOPATH...")
+	if planFormat != "" && planFormat != "text" && planFormat != "json" {
+		fmt.Fprintln(os.Stderr, "The -plan flag must be text or json.")
+		os.Exit(1)
+	}
 
-	if err := CopyGopath(pkgName, newGopath, keepTests); err != nil {
-		moreInfo := "\nNote: Setting GO111MODULE env variable to `off` may resolve the above error."
-		fmt.Fprintln(os.Stderr, "Failed to copy into a new GOPATH:", err, moreInfo)
-		return false
+	if encryptMapping && (mappingPath == "" || customPadding == "") {
+		fmt.Fprintln(os.Stderr, "The -encryptmapping flag requires -mapping and -padding.")
+		os.Exit(1)
 	}
-	var n NameHasher
-	if customPadding == "" {
-		buf := make([]byte, 32)
-		rand.Read(buf)
-		n = buf
-	} else {
-		n = []byte(customPadding)
+
+	if !obfuscate(targets) {
+		os.Exit(1)
 	}
+}
 
-	log.Println("Obfuscating package names...")
-	if err := ObfuscatePackageNames(newGopath, n); err != nil {
-		fmt.Fprintln(os.Stderr, "Failed to obfuscate package names:", err)
-		return false
+// parseTargets parses either a single pair of pkg_name and
+// out_path arguments, or any number of pkg_name=out_path
+// arguments. With -plan, a lone pkg_name is accepted too.
+func parseTargets(args []string) ([]obfuscator.Target, bool) {
+	if len(args) == 2 && !strings.Contains(args[0], "=") {
+		return []obfuscator.Target{{Package: args[0], Output: args[1]}}, true
+	}
+	if len(args) == 1 && planFormat != "" && !strings.Contains(args[0], "=") {
+		// A plan does not produce any output.
+		return []obfuscator.Target{{Package: args[0]}}, true
+	}
+	if len(args) == 0 {
+		return nil, false
+	}
+	var res []obfuscator.Target
+	for _, arg := range args {
+		parts := strings.SplitN(arg, "=", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, false
+		}
+		res = append(res, obfuscator.Target{Package: parts[0], Output: parts[1]})
 	}
-	log.Println("Obfuscating strings...")
-	if err := ObfuscateStrings(newGopath); err != nil {
-		fmt.Fprintln(os.Stderr, "Failed to obfuscate strings:", err)
+	return res, true
+}
+
+func obfuscate(targets []obfuscator.Target) bool {
+	opts := obfuscator.Options{
+		Targets:             targets,
+		Padding:             obfuscator.NameHasher(customPadding),
+		KeepTests:           keepTests,
+		PreservePackageName: preservePackageName,
+		InjectTags:          injectTags,
+		DryRun:              planFormat != "",
+		BuildOptions: obfuscator.BuildOptions{
+			Tags:         tags,
+			WinHide:      winHide,
+			NoStaticLink: noStaticLink,
+			Verbose:      verbose,
+		},
+	}
+	cipher, err := obfuscator.ParseStringCipher(stringCipher)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to parse strings flag:", err)
 		return false
 	}
-	log.Println("Obfuscating symbols...")
-	if err := ObfuscateSymbols(newGopath, n); err != nil {
-		fmt.Fprintln(os.Stderr, "Failed to obfuscate symbols:", err)
-		return false
+	opts.Strings = cipher
+
+	if seed != "" {
+		seedValue, err := strconv.ParseInt(seed, 10, 64)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Failed to parse seed:", err)
+			return false
+		}
+		opts.Rand = rand.New(rand.NewSource(seedValue))
 	}
 
 	if outputGopath {
-		return true
+		opts.Mode = obfuscator.OutputGopath
+	} else if outputModule {
+		opts.Mode = obfuscator.OutputModule
 	}
 
-	ctx := build.Default
-
-	newPkg := pkgName
-	if !preservePackageName {
-		newPkg = encryptComponents(pkgName, n)
+	if policyPath != "" {
+		policy, err := obfuscator.ReadPolicy(policyPath)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Failed to read config:", err)
+			return false
+		}
+		opts.Policy = policy
 	}
 
-	ldflags := `-s -w`
-	if winHide {
-		ldflags += " -H=windowsgui"
-	}
-	if !noStaticLink {
-		ldflags += ` -extldflags '-static'`
+	if platforms != "" {
+		configs, err := obfuscator.ParseBuildConfigs(platforms)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Failed to parse platforms:", err)
+			return false
+		}
+		opts.Configs = configs
 	}
 
-	goCache := newGopath + "/cache"
-	os.Mkdir(goCache, 0755)
+	if importMappingPath != "" {
+		key := obfuscator.MappingKey(opts.Padding)
+		mapping, err := obfuscator.ReadMapping(importMappingPath, key)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Failed to import mapping:", err)
+			return false
+		}
+		opts.ImportMapping = mapping
+	}
 
-	arguments := []string{"build", "-trimpath", "-ldflags", ldflags, "-tags", tags, "-o", outPath, newPkg}
-	environment := []string{
-		"GO111MODULE=off", // needs to be off to make Go search GOPATH
-		"GOROOT=" + ctx.GOROOT,
-		"GOARCH=" + ctx.GOARCH,
-		"GOOS=" + ctx.GOOS,
-		"GOPATH=" + newGopath,
-		"PATH=" + os.Getenv("PATH"),
-		"GOCACHE=" + goCache,
+	res, err := obfuscator.Obfuscate(context.Background(), opts)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to obfuscate:", err)
+		return false
 	}
 
-	cmd := exec.Command("go", arguments...)
-	cmd.Env = environment
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
+	if planFormat != "" {
+		if err := writePlan(os.Stdout, res, planFormat); err != nil {
+			fmt.Fprintln(os.Stderr, "Failed to write plan:", err)
+			return false
+		}
+		return true
+	}
 
 	if verbose {
-		fmt.Println()
-		fmt.Println("[Verbose] Temporary path:", newGopath)
-		fmt.Println("[Verbose] Go build command: go", strings.Join(arguments, " "))
-		fmt.Println("[Verbose] Environment variables:")
-		for _, envLine := range environment {
-			fmt.Println(envLine)
+		for _, skip := range res.Skipped {
+			log.Printf("Skipped %s %s (%s): %s", skip.Kind, skip.Name, skip.Position, skip.Reason)
+		}
+		for _, l := range res.Linknames {
+			log.Printf("Rewrote directive (%s): %s => %s", l.Position, l.Old, l.New)
 		}
-		fmt.Println()
+	} else if len(res.Skipped) > 0 {
+		log.Printf("Skipped %d names (use -verbose to list them)", len(res.Skipped))
 	}
 
-	if err := cmd.Run(); err != nil {
-		fmt.Fprintln(os.Stderr, "Failed to compile:", err)
-		return false
+	if mappingPath != "" {
+		var key []byte
+		if encryptMapping {
+			key = obfuscator.MappingKey(res.Padding)
+		}
+		if err := obfuscator.WriteMapping(mappingPath, res.Mapping, key); err != nil {
+			fmt.Fprintln(os.Stderr, "Failed to write mapping:", err)
+			return false
+		}
 	}
-
 	return true
 }
-
-func encryptComponents(pkgName string, n NameHasher) string {
-	comps := strings.Split(pkgName, "/")
-	for i, comp := range comps {
-		comps[i] = n.Hash(comp)
-	}
-	return strings.Join(comps, "/")
-}
@@ -0,0 +1,144 @@
+package obfuscator
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// asmSymbolExpr matches references to Go symbols in Plan 9
+// assembly, such as "·add" or "example.com∕pkg·Table".
+// The package path, which uses "∕" in place of "/", and the
+// name are captured.
+var asmSymbolExpr = regexp.MustCompile(`([\p{L}\p{N}_.~\-∕]*)·([\p{L}\p{N}_]+)`)
+
+var asmIdentExpr = regexp.MustCompile(`[\p{L}\p{N}_]+`)
+
+const asmIgnoredReason = "may be referred to by assembly through go_asm.h"
+
+// asmFiles lists the assembly files in a directory, along
+// with the headers that they may include.
+// Headers are only listed if there is assembly as well.
+func asmFiles(dir string) []string {
+	listing, _ := ioutil.ReadDir(dir)
+	var sources, headers []string
+	for _, item := range listing {
+		switch filepath.Ext(item.Name()) {
+		case ".s":
+			sources = append(sources, filepath.Join(dir, item.Name()))
+		case ".h":
+			headers = append(headers, filepath.Join(dir, item.Name()))
+		}
+	}
+	if len(sources) == 0 {
+		return nil
+	}
+	return append(sources, headers...)
+}
+
+// asmPackageRefs finds the packages which the assembly in
+// a directory refers to by path.
+func asmPackageRefs(dir string) ([]string, error) {
+	var res []string
+	for _, path := range asmFiles(dir) {
+		contents, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range asmSymbolExpr.FindAllStringSubmatch(string(contents), -1) {
+			if m[1] != "" {
+				res = append(res, strings.Replace(m[1], "∕", "/", -1))
+			}
+		}
+	}
+	return res, nil
+}
+
+// asmIgnoredDecls finds the names of declarations in a
+// package which its assembly refers to in ways that cannot
+// be renamed.
+//
+// These are the constants and types which the generated
+// go_asm.h header exposes as const_Name, Type_field and
+// Type__size.
+func asmIgnoredDecls(pkg *WorkspacePackage) (map[string]string, error) {
+	res := map[string]string{}
+	for _, path := range asmFiles(pkg.Build.Dir) {
+		contents, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if !strings.Contains(string(contents), `"go_asm.h"`) {
+			continue
+		}
+		for _, ident := range asmIdentExpr.FindAllString(string(contents), -1) {
+			if strings.HasPrefix(ident, "const_") {
+				res[strings.TrimPrefix(ident, "const_")] = asmIgnoredReason
+			}
+			for i := 1; i < len(ident); i++ {
+				if ident[i] == '_' {
+					res[ident[:i]] = asmIgnoredReason
+				}
+			}
+		}
+	}
+	return res, nil
+}
+
+// applyAsm rewrites the assembly files of a package to use
+// the new names of the Go symbols that they refer to, and
+// the new paths of the packages those symbols belong to.
+//
+// References to symbols which are not being renamed, such
+// as symbols declared only in assembly, are left alone.
+func (r *Renamer) applyAsm(pkg *WorkspacePackage) error {
+	for _, path := range asmFiles(pkg.Build.Dir) {
+		contents, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		var edits []edit
+		for _, m := range asmSymbolExpr.FindAllSubmatchIndex(contents, -1) {
+			refPath := strings.Replace(string(contents[m[2]:m[3]]), "∕", "/", -1)
+			name := string(contents[m[4]:m[5]])
+			target := pkg.Build.ImportPath
+			if refPath != "" {
+				target = refPath
+				if newPath, ok := r.Packages[refPath]; ok {
+					edits = append(edits, edit{
+						Start: m[2],
+						End:   m[3],
+						Text:  strings.Replace(newPath, "/", "∕", -1),
+					})
+				}
+			}
+			if newName, ok := r.asmSymbolName(target, name); ok {
+				edits = append(edits, edit{Start: m[4], End: m[5], Text: newName})
+			}
+		}
+		if len(edits) == 0 {
+			continue
+		}
+		if err := ioutil.WriteFile(path, applyEdits(contents, edits), 0755); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// asmSymbolName finds the new name of a top-level symbol
+// in any of the workspaces, since assembly for one platform
+// may refer to Go code which is only part of that platform.
+func (r *Renamer) asmSymbolName(pkgPath, name string) (string, bool) {
+	for _, w := range r.workspaces() {
+		if pkg, ok := w.Packages[pkgPath]; ok {
+			if obj := pkg.Types.Scope().Lookup(name); obj != nil {
+				if newName, ok := r.Objects[obj]; ok {
+					return newName, true
+				}
+			}
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,130 @@
+package obfuscator
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestAsmSymbols(t *testing.T) {
+	if runtime.GOARCH != "amd64" {
+		t.Skip("the test assembly is for amd64")
+	}
+	dir := writeTestFiles(t, map[string]string{
+		"go.mod": "module app\n\ngo 1.22\n",
+		"nums/nums.go": `package nums
+
+var Scale int64 = 3
+`,
+		"calc/calc.go": `package calc
+
+import "app/nums"
+
+var calls int64
+
+func bump() { calls++ }
+
+func add(a, b int64) int64
+
+func Add(a, b int64) (int64, int64) {
+	return add(a, b), calls + nums.Scale - 3
+}
+`,
+		"calc/calc_amd64.s": `#include "textflag.h"
+
+DATA ·bias+0(SB)/8, $100
+GLOBL ·bias(SB), RODATA, $8
+
+// func add(a, b int64) int64
+TEXT ·add(SB), $0-24
+	CALL ·bump(SB)
+	MOVQ a+0(FP), AX
+	ADDQ b+8(FP), AX
+	ADDQ ·bias(SB), AX
+	MOVQ app∕nums·Scale(SB), BX
+	IMULQ BX, AX
+	MOVQ AX, ret+16(FP)
+	RET
+`,
+		"cmd/app/main.go": `package main
+
+import (
+	"fmt"
+
+	"app/calc"
+)
+
+func main() { fmt.Println(calc.Add(1, 2)) }
+`,
+	})
+	res, output := runObfuscated(t, dir, "app/cmd/app", Options{})
+	if expected := "309 1\n"; output != expected {
+		t.Errorf("got output %q, expected %q", output, expected)
+	}
+
+	// Assembly cannot spell a dot in a package path.
+	renames := testRenames(res)
+	if path := renames["app/nums"]; path == "" || strings.Contains(path, ".") {
+		t.Errorf("app/nums was moved to %q", path)
+	}
+	for _, name := range []string{"app/calc.add", "app/calc.bump", "app/nums.Scale"} {
+		if _, ok := renames[name]; !ok {
+			t.Errorf("%s was not renamed", name)
+		}
+	}
+}
+
+func TestApplyAsm(t *testing.T) {
+	dir := writeTestFiles(t, map[string]string{
+		"go.mod": "module example.com/app\n\ngo 1.22\n",
+		"calc/calc.go": `package calc
+
+var table [2]int64
+
+func sum() int64
+
+func Sum() int64 { return sum() + table[0] }
+`,
+		"calc/calc_amd64.s": `DATA ·local+0(SB)/8, $1
+GLOBL ·local(SB), 8, $8
+
+TEXT ·sum(SB), 4, $0-8
+	CALL ·sum(SB)
+	MOVQ ·table+8(SB), AX
+	RET
+`,
+		"cmd/app/main.go": `package main
+
+import "example.com/app/calc"
+
+func main() { println(calc.Sum()) }
+`,
+	})
+	outDir := filepath.Join(dir, "out")
+	res := obfuscateTest(t, dir, Options{
+		Targets: []Target{{Package: "example.com/app/cmd/app", Output: outDir}},
+		Mode:    OutputGopath,
+	})
+	renames := testRenames(res)
+	calcPath := renames["example.com/app/calc"]
+	contents, err := ioutil.ReadFile(filepath.Join(outDir, "src", filepath.FromSlash(calcPath),
+		"calc_amd64.s"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := lastIdentifier(renames["example.com/app/calc.sum"])
+	table := lastIdentifier(renames["example.com/app/calc.table"])
+	expected := `DATA ·local+0(SB)/8, $1
+GLOBL ·local(SB), 8, $8
+
+TEXT ·` + sum + `(SB), 4, $0-8
+	CALL ·` + sum + `(SB)
+	MOVQ ·` + table + `+8(SB), AX
+	RET
+`
+	if actual := string(contents); actual != expected {
+		t.Errorf("got assembly:\n%s\nexpected:\n%s", actual, strings.TrimSpace(expected))
+	}
+}
@@ -0,0 +1,77 @@
+package obfuscator
+
+import (
+	"go/ast"
+	"regexp"
+	"strings"
+)
+
+var cgoIdentExpr = regexp.MustCompile(`[A-Za-z_][A-Za-z0-9_]*`)
+
+// cgoIgnoredDecls finds the names of declarations in a
+// package which C code may refer to.
+//
+// These are the functions marked with //export, and any
+// names which appear in the C preamble of a file that
+// imports "C". Since C code refers to them by name, they
+// are kept rather than renamed.
+// Names used through the C pseudo-package, like C.free,
+// belong to C rather than the package, so they are never
+// renamed in the first place.
+func cgoIgnoredDecls(pkg *WorkspacePackage) map[string]string {
+	res := map[string]string{}
+	for _, file := range pkg.Files {
+		if !importsC(file) {
+			continue
+		}
+		for _, decl := range file.Decls {
+			switch d := decl.(type) {
+			case *ast.FuncDecl:
+				if name, ok := cgoExportName(d); ok {
+					res[name] = "exported to C with //export"
+				}
+			case *ast.GenDecl:
+				for _, spec := range d.Specs {
+					spec, ok := spec.(*ast.ImportSpec)
+					if !ok || spec.Path.Value != `"C"` {
+						continue
+					}
+					for _, doc := range []*ast.CommentGroup{d.Doc, spec.Doc} {
+						if doc == nil {
+							continue
+						}
+						for _, ident := range cgoIdentExpr.FindAllString(doc.Text(), -1) {
+							if _, ok := res[ident]; !ok {
+								res[ident] = "may be referred to by the C preamble"
+							}
+						}
+					}
+				}
+			}
+		}
+	}
+	return res
+}
+
+// cgoExportName finds the name that a function is exported
+// to C with, if it has an //export directive.
+func cgoExportName(decl *ast.FuncDecl) (string, bool) {
+	if decl.Doc == nil || decl.Recv != nil {
+		return "", false
+	}
+	for _, comment := range decl.Doc.List {
+		if fields := strings.Fields(comment.Text); len(fields) == 2 && fields[0] == "//export" {
+			return fields[1], true
+		}
+	}
+	return "", false
+}
+
+func importsC(file *ast.File) bool {
+	for _, spec := range file.Imports {
+		if spec.Path.Value == `"C"` {
+			return true
+		}
+	}
+	return false
+}
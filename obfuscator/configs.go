@@ -0,0 +1,206 @@
+package obfuscator
+
+import (
+	"fmt"
+	"go/build"
+	"go/types"
+	"sort"
+	"strings"
+)
+
+// A BuildConfig is a target platform and a set of build
+// tags which a workspace can be type-checked for.
+//
+// Empty fields default to those of the go command.
+type BuildConfig struct {
+	GOOS   string
+	GOARCH string
+	Tags   []string
+}
+
+// HostConfig creates a BuildConfig for the platform that
+// the go command builds for by default.
+func HostConfig(tags []string) BuildConfig {
+	return BuildConfig{GOOS: build.Default.GOOS, GOARCH: build.Default.GOARCH, Tags: tags}
+}
+
+// ParseBuildConfigs parses a comma-separated list of build
+// configurations, each of which is a platform optionally
+// followed by tags, like "linux/amd64,windows/386+sqlite".
+func ParseBuildConfigs(s string) ([]BuildConfig, error) {
+	var res []BuildConfig
+	for _, item := range strings.Split(s, ",") {
+		parts := strings.Split(strings.TrimSpace(item), "+")
+		platform := strings.Split(parts[0], "/")
+		if len(platform) != 2 || platform[0] == "" || platform[1] == "" {
+			return nil, fmt.Errorf("invalid build configuration: %q", item)
+		}
+		config := BuildConfig{GOOS: platform[0], GOARCH: platform[1]}
+		for _, tag := range parts[1:] {
+			if tag == "" {
+				return nil, fmt.Errorf("invalid build configuration: %q", item)
+			}
+			config.Tags = append(config.Tags, tag)
+		}
+		res = append(res, config)
+	}
+	return res, nil
+}
+
+// SplitTags splits a list of build tags as accepted by the
+// -tags flag of the go command.
+func SplitTags(tags string) []string {
+	return strings.FieldsFunc(tags, func(r rune) bool {
+		return r == ',' || r == ' '
+	})
+}
+
+// String formats the config the same way that it is parsed
+// by ParseBuildConfigs.
+func (c BuildConfig) String() string {
+	ctx := c.context()
+	return strings.Join(append([]string{ctx.GOOS + "/" + ctx.GOARCH}, c.Tags...), "+")
+}
+
+func (c BuildConfig) context() build.Context {
+	ctx := build.Default
+	if c.GOOS != "" {
+		ctx.GOOS = c.GOOS
+	}
+	if c.GOARCH != "" {
+		ctx.GOARCH = c.GOARCH
+	}
+	if ctx.GOOS != build.Default.GOOS || ctx.GOARCH != build.Default.GOARCH {
+		// Like the go command, disable CGO when cross-compiling.
+		ctx.CgoEnabled = false
+	}
+	ctx.BuildTags = c.Tags
+	return ctx
+}
+
+// goArgs creates the environment and flags which make the
+// go command use the config.
+func (c BuildConfig) goArgs() (env, flags []string) {
+	ctx := c.context()
+	env = []string{"GOOS=" + ctx.GOOS, "GOARCH=" + ctx.GOARCH}
+	if len(c.Tags) > 0 {
+		flags = []string{"-tags", strings.Join(c.Tags, ",")}
+	}
+	return env, flags
+}
+
+// reconcile adds the renames found in every workspace to
+// r.Objects, along with the tags that they need.
+//
+// A declaration is only renamed if it gets the same new
+// name in every workspace that declares it, since files
+// which are shared between workspaces are edited once.
+func (r *Renamer) reconcile(renames map[types.Object]string) {
+	type decision struct {
+		Name    string
+		Renamed bool
+
+		// Config is the first configuration which did not
+		// rename the declaration.
+		Config BuildConfig
+	}
+	decisions := map[string]*decision{}
+	for _, w := range r.workspaces() {
+		for _, obj := range declaredObjects(w) {
+			key := r.declKey(obj)
+			name, renamed := renames[obj]
+			d, ok := decisions[key]
+			if !ok {
+				decisions[key] = &decision{Name: name, Renamed: renamed, Config: w.Config}
+			} else if d.Renamed && (!renamed || name != d.Name) {
+				d.Renamed = false
+				d.Config = w.Config
+			}
+		}
+	}
+
+	var dropped []*Skip
+	for obj, name := range renames {
+		if d := decisions[r.declKey(obj)]; d != nil && !d.Renamed {
+			dropped = append(dropped, &Skip{
+				Kind:     objectKind(obj),
+				Name:     r.qualifiedName(obj, false),
+				Position: r.objectPosition(obj),
+				Reason:   "cannot be renamed consistently in the " + d.Config.String() + " build configuration",
+			})
+			continue
+		}
+		r.Objects[obj] = name
+	}
+	sort.Slice(dropped, func(i, j int) bool {
+		return dropped[i].Position < dropped[j].Position
+	})
+
+	seen := map[Skip]bool{}
+	var skipped []*Skip
+	for _, skip := range append(r.Skipped, dropped...) {
+		if !seen[*skip] {
+			seen[*skip] = true
+			skipped = append(skipped, skip)
+		}
+	}
+	r.Skipped = skipped
+
+	// Tags are injected into the declaration of a field in
+	// every workspace, with the keys needed by any of them.
+	tagKeys := map[string]map[string]bool{}
+	for field, keys := range r.fieldTags {
+		key := r.declKey(field)
+		if tagKeys[key] == nil {
+			tagKeys[key] = map[string]bool{}
+		}
+		for _, tagKey := range keys {
+			tagKeys[key][tagKey] = true
+		}
+	}
+	for field, decl := range r.fieldDecls {
+		keySet := tagKeys[r.declKey(field)]
+		if _, ok := r.Objects[field]; !ok || len(keySet) == 0 {
+			continue
+		}
+		var keys []string
+		for key := range keySet {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		if tag, reason := injectedTag(decl, field.Name(), keys); reason == "" {
+			r.Tags[decl] = tag
+		}
+	}
+}
+
+// declKey identifies a declaration across workspaces.
+func (r *Renamer) declKey(obj types.Object) string {
+	return r.objectPosition(obj) + " " + obj.Name()
+}
+
+// declaredObjects finds the objects in a workspace which
+// could be renamed: top-level declarations, methods and
+// struct fields.
+func declaredObjects(w *Workspace) []types.Object {
+	var res []types.Object
+	for _, pkg := range w.SortedPackages() {
+		for _, ident := range sortedIdents(pkg.Info.Defs) {
+			switch obj := pkg.Info.Defs[ident].(type) {
+			case *types.Var:
+				if obj.IsField() || obj.Parent() == pkg.Types.Scope() {
+					res = append(res, obj)
+				}
+			case *types.Func:
+				if obj.Type().(*types.Signature).Recv() != nil || obj.Parent() == pkg.Types.Scope() {
+					res = append(res, obj)
+				}
+			case *types.TypeName, *types.Const:
+				if obj.Parent() == pkg.Types.Scope() {
+					res = append(res, obj)
+				}
+			}
+		}
+	}
+	return res
+}
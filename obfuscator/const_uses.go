@@ -0,0 +1,297 @@
+package obfuscator
+
+import (
+	"fmt"
+	"go/ast"
+	"go/constant"
+	"go/token"
+	"go/types"
+	"sort"
+)
+
+// A constUse is a constant string expression which refers
+// to string constants, or which has a named string type, so
+// that it cannot be handled like a plain string literal.
+//
+// Declarations of constants are never changed, so uses
+// which must be constant, like other constant declarations,
+// array lengths and switch cases, keep working.
+type constUse struct {
+	Start int
+	End   int
+	Value string
+
+	// Conversion is the name of the type that the value is
+	// converted to, or "" if it is a plain string.
+	Conversion string
+
+	// Names are the constants which the expression uses.
+	// If there are none, the expression only consists of
+	// literals.
+	Names []string
+
+	// Keep is set for expressions which must be left as
+	// they are, along with the literals inside of them.
+	Keep bool
+}
+
+// Code produces the code which replaces the expression,
+// given the code for its value.
+func (c *constUse) Code(value []byte) []byte {
+	if c.Conversion == "" {
+		return value
+	}
+	return []byte(c.Conversion + "(" + string(value) + ")")
+}
+
+// findConstUses type-checks a GOPATH for every build
+// configuration, and finds the uses of string constants
+// and the literals of named string types, keyed by file
+// path.
+//
+// A use is kept unless every configuration which checks its
+// file agrees on its value and type, since a constant may
+// be declared differently for every platform.
+func findConstUses(gopath string, configs []BuildConfig) (map[string][]*constUse, error) {
+	if len(configs) == 0 {
+		configs = []BuildConfig{{}}
+	}
+	type useKey struct {
+		Path       string
+		Start, End int
+	}
+	found := map[useKey]*constUse{}
+	agreeing := map[useKey]int{}
+	conflicts := map[useKey]bool{}
+	checked := map[string]int{}
+
+	fset := token.NewFileSet()
+	for _, config := range configs {
+		w, err := LoadWorkspaceConfig(gopath, config, fset)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", config, err)
+		}
+		for _, pkg := range w.SortedPackages() {
+			for _, file := range pkg.Files {
+				path := fset.File(file.Pos()).Name()
+				checked[path]++
+				for _, use := range fileConstUses(w, pkg, file) {
+					key := useKey{Path: path, Start: use.Start, End: use.End}
+					if prev, ok := found[key]; !ok {
+						found[key] = use
+					} else if prev.Value != use.Value || prev.Conversion != use.Conversion ||
+						prev.Keep != use.Keep {
+						conflicts[key] = true
+					}
+					agreeing[key]++
+				}
+			}
+		}
+	}
+
+	res := map[string][]*constUse{}
+	for key, use := range found {
+		if conflicts[key] || agreeing[key] != checked[key.Path] {
+			use.Keep = true
+		}
+		res[key.Path] = append(res[key.Path], use)
+	}
+	for _, uses := range res {
+		sort.Slice(uses, func(i, j int) bool {
+			return uses[i].Start < uses[j].Start
+		})
+	}
+	return res, nil
+}
+
+// fileConstUses finds the uses of string constants from
+// the workspace in a file, and the literals of named string
+// types, outside of functions marked with
+// //gobfuscate:nostrings.
+//
+// Every use is widened to the largest constant expression
+// around it, so that `prefix + "x"` is replaced as a whole.
+// Expressions which are not strings, like `len(prefix)` or
+// `len("x")`, are kept, since they do not contain the
+// string and may have to be constant.
+func fileConstUses(w *Workspace, pkg *WorkspacePackage, file *ast.File) []*constUse {
+	var res []*constUse
+	seen := map[ast.Expr]bool{}
+	var stack []ast.Node
+	ast.Inspect(file, func(n ast.Node) bool {
+		if n == nil {
+			stack = stack[:len(stack)-1]
+			return true
+		}
+		switch n := n.(type) {
+		case *ast.FuncDecl:
+			if hasDirective(n.Doc, noStringsDirective) {
+				return false
+			}
+		case *ast.GenDecl:
+			if n.Tok == token.CONST || n.Tok == token.IMPORT {
+				return false
+			}
+		case *ast.Ident, *ast.BasicLit:
+			if use := leafConstUse(w, pkg, file, append(stack, n), seen); use != nil {
+				res = append(res, use)
+			}
+		}
+		stack = append(stack, n)
+		return true
+	})
+	return res
+}
+
+func leafConstUse(w *Workspace, pkg *WorkspacePackage, file *ast.File, path []ast.Node,
+	seen map[ast.Expr]bool) *constUse {
+	switch leaf := path[len(path)-1].(type) {
+	case *ast.Ident:
+		if workspaceStringConst(w, pkg, leaf) == nil {
+			return nil
+		}
+	case *ast.BasicLit:
+		if leaf.Kind != token.STRING {
+			return nil
+		}
+	}
+
+	idx := len(path) - 1
+	for idx > 0 {
+		parent, ok := path[idx-1].(ast.Expr)
+		if !ok || pkg.Info.Types[parent].Value == nil {
+			break
+		}
+		idx--
+	}
+	expr := path[idx].(ast.Expr)
+	if seen[expr] {
+		return nil
+	}
+	seen[expr] = true
+	tv := pkg.Info.Types[expr]
+	if tv.Value == nil {
+		return nil
+	}
+
+	use := &constUse{
+		Start: w.Fset.Position(expr.Pos()).Offset,
+		End:   w.Fset.Position(expr.End()).Offset,
+	}
+	ast.Inspect(expr, func(n ast.Node) bool {
+		if id, ok := n.(*ast.Ident); ok {
+			if c := workspaceStringConst(w, pkg, id); c != nil {
+				use.Names = append(use.Names, c.Name())
+			}
+		}
+		return true
+	})
+	if tv.Value.Kind() != constant.String || !isStringType(tv.Type) {
+		use.Keep = true
+		return use
+	}
+	if len(use.Names) > 0 && inConstContext(path[:idx+1]) {
+		use.Keep = true
+		return use
+	}
+	conversion, ok := typeNameAt(pkg, file, tv.Type, expr.Pos())
+	if !ok {
+		use.Keep = true
+		return use
+	}
+	if len(use.Names) == 0 && conversion == "" {
+		// Plain string literals are replaced one by one.
+		return nil
+	}
+	use.Value = constant.StringVal(tv.Value)
+	use.Conversion = conversion
+	return use
+}
+
+// workspaceStringConst finds the string constant that an
+// identifier refers to, if it is declared in the workspace.
+func workspaceStringConst(w *Workspace, pkg *WorkspacePackage, ident *ast.Ident) *types.Const {
+	obj, ok := pkg.Info.Uses[ident].(*types.Const)
+	if !ok || obj.Pkg() == nil || w.Packages[obj.Pkg().Path()] == nil || !isStringType(obj.Type()) {
+		return nil
+	}
+	return obj
+}
+
+// inConstContext checks if the last node of a path is in a
+// place where a constant is required, namely the length of
+// an array, or the values of a switch case, which are
+// checked for duplicates.
+//
+// Constant declarations are never visited in the first
+// place.
+func inConstContext(path []ast.Node) bool {
+	for i := len(path) - 2; i >= 0; i-- {
+		child := path[i+1]
+		switch parent := path[i].(type) {
+		case *ast.CaseClause:
+			for _, x := range parent.List {
+				if x == child {
+					return true
+				}
+			}
+		case *ast.ArrayType:
+			if parent.Len == child {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// typeNameAt finds the code which names a string type at a
+// position in a file, or "" for the string type itself.
+//
+// It fails if the type cannot be named there, for example
+// because its package is not imported by the file.
+func typeNameAt(pkg *WorkspacePackage, file *ast.File, t types.Type, pos token.Pos) (string, bool) {
+	if b, ok := t.(*types.Basic); ok {
+		return "", b.Kind() == types.String || b.Kind() == types.UntypedString
+	}
+	if named, ok := t.(*types.Named); ok && named.TypeArgs().Len() > 0 {
+		return "", false
+	}
+	typeObj, ok := t.(interface{ Obj() *types.TypeName })
+	if !ok || pkg.Types == nil {
+		return "", false
+	}
+	obj := typeObj.Obj()
+	scope := pkg.Types.Scope().Innermost(pos)
+	if scope == nil {
+		return "", false
+	}
+	if obj.Pkg() == pkg.Types {
+		if _, found := scope.LookupParent(obj.Name(), pos); found == obj {
+			return obj.Name(), true
+		}
+		return "", false
+	}
+	if obj.Pkg() == nil || !obj.Exported() {
+		return "", false
+	}
+	for _, spec := range file.Imports {
+		var pkgName *types.PkgName
+		if spec.Name != nil {
+			pkgName, _ = pkg.Info.Defs[spec.Name].(*types.PkgName)
+		} else {
+			pkgName, _ = pkg.Info.Implicits[spec].(*types.PkgName)
+		}
+		if pkgName == nil || pkgName.Imported() != obj.Pkg() {
+			continue
+		}
+		if _, found := scope.LookupParent(pkgName.Name(), pos); found == pkgName {
+			return pkgName.Name() + "." + obj.Name(), true
+		}
+	}
+	return "", false
+}
+
+func isStringType(t types.Type) bool {
+	b, ok := t.Underlying().(*types.Basic)
+	return ok && b.Info()&types.IsString != 0
+}
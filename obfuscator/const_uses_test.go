@@ -0,0 +1,88 @@
+package obfuscator
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestConstUses(t *testing.T) {
+	dir := writeTestFiles(t, map[string]string{
+		"go.mod": "module example.com/app\n\ngo 1.22\n",
+		"enum/enum.go": `package enum
+
+type Color string
+
+const (
+	Red   Color = "crimson red"
+	Green Color = "forest green"
+)
+
+const greeting = "hello"
+
+const Full = greeting + ", constant world"
+
+var Sizes [len(Full)]int
+
+type Level int
+
+const (
+	Low Level = iota
+	Mid
+	High
+)
+
+const levelNames = "lowmidhigh"
+
+var levelEnds = [...]int{Low: 3, Mid: 6, High: len(levelNames)}
+
+func (l Level) String() string {
+	start := 0
+	if l > Low {
+		start = levelEnds[l-1]
+	}
+	return levelNames[start:levelEnds[l]]
+}
+
+func Describe(c Color) string {
+	switch c {
+	case Red:
+		return "warm " + string(c)
+	case Green:
+		return "cool " + string(Green)
+	}
+	return "unknown"
+}
+`,
+		"cmd/app/main.go": `package main
+
+import (
+	"fmt"
+
+	"example.com/app/enum"
+)
+
+func main() {
+	fmt.Println(enum.Full, len(enum.Sizes))
+	fmt.Println(enum.Describe(enum.Red), enum.Describe(enum.Green), enum.Describe("x"))
+	fmt.Println(enum.Low, enum.Mid, enum.High)
+}
+`,
+	})
+	_, output := runObfuscated(t, dir, "example.com/app/cmd/app", Options{})
+	expected := "hello, constant world 21\nwarm crimson red cool forest green unknown\nlow mid high\n"
+	if output != expected {
+		t.Errorf("got output %q, expected %q", output, expected)
+	}
+
+	binary, err := ioutil.ReadFile(filepath.Join(dir, "obfuscated_binary"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, text := range []string{"hello, constant world", "lowmidhigh"} {
+		if bytes.Contains(binary, []byte(text)) {
+			t.Errorf("the binary contains %q", text)
+		}
+	}
+}
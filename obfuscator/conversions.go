@@ -0,0 +1,187 @@
+package obfuscator
+
+import (
+	"go/ast"
+	"go/types"
+)
+
+// conversions calls fn for every value in a package which
+// is converted from one type to a different type, either
+// explicitly or implicitly (by assignment, function call,
+// return, channel send or composite literal).
+//
+// For arguments of calls to functions and methods which are
+// known statically, the callee is passed to fn as well.
+func conversions(pkg *WorkspacePackage, fn func(from, to types.Type, callee *types.Func)) {
+	v := &conversionVisitor{info: pkg.Info, fn: fn}
+	for _, file := range pkg.Files {
+		ast.Walk(v, file)
+	}
+}
+
+type conversionVisitor struct {
+	info *types.Info
+	fn   func(from, to types.Type, callee *types.Func)
+
+	// sig is the signature of the enclosing function.
+	sig *types.Signature
+}
+
+func (v *conversionVisitor) Visit(node ast.Node) ast.Visitor {
+	switch node := node.(type) {
+	case *ast.FuncDecl:
+		if obj, ok := v.info.Defs[node.Name].(*types.Func); ok {
+			return &conversionVisitor{info: v.info, fn: v.fn, sig: obj.Type().(*types.Signature)}
+		}
+	case *ast.FuncLit:
+		if sig, ok := v.typeOf(node).(*types.Signature); ok {
+			return &conversionVisitor{info: v.info, fn: v.fn, sig: sig}
+		}
+	case *ast.CallExpr:
+		v.call(node)
+	case *ast.AssignStmt:
+		if len(node.Lhs) == len(node.Rhs) {
+			for i, rhs := range node.Rhs {
+				v.convert(rhs, v.typeOf(node.Lhs[i]))
+			}
+		}
+	case *ast.ValueSpec:
+		if node.Type != nil && len(node.Names) == len(node.Values) {
+			for _, value := range node.Values {
+				v.convert(value, v.typeOf(node.Type))
+			}
+		}
+	case *ast.ReturnStmt:
+		if v.sig != nil && len(node.Results) == v.sig.Results().Len() {
+			for i, result := range node.Results {
+				v.convert(result, v.sig.Results().At(i).Type())
+			}
+		}
+	case *ast.SendStmt:
+		if ch, ok := underlying(v.typeOf(node.Chan)).(*types.Chan); ok {
+			v.convert(node.Value, ch.Elem())
+		}
+	case *ast.CompositeLit:
+		v.compositeLit(node)
+	}
+	return v
+}
+
+func (v *conversionVisitor) call(call *ast.CallExpr) {
+	tv, ok := v.info.Types[call.Fun]
+	if !ok {
+		return
+	}
+	if tv.IsType() {
+		if len(call.Args) == 1 {
+			v.convert(call.Args[0], tv.Type)
+		}
+		return
+	}
+	var callee *types.Func
+	switch fun := ast.Unparen(call.Fun).(type) {
+	case *ast.Ident:
+		callee, _ = v.info.Uses[fun].(*types.Func)
+	case *ast.SelectorExpr:
+		callee, _ = v.info.Uses[fun.Sel].(*types.Func)
+	case *ast.IndexExpr:
+		callee = v.genericCallee(fun.X)
+	case *ast.IndexListExpr:
+		callee = v.genericCallee(fun.X)
+	}
+	sig, ok := underlying(tv.Type).(*types.Signature)
+	if !ok {
+		return
+	}
+	params := sig.Params()
+	for i, arg := range call.Args {
+		var to types.Type
+		if sig.Variadic() && i >= params.Len()-1 {
+			to = params.At(params.Len() - 1).Type()
+			if slice, ok := to.(*types.Slice); ok && !call.Ellipsis.IsValid() {
+				to = slice.Elem()
+			}
+		} else if i < params.Len() {
+			to = params.At(i).Type()
+		}
+		v.convertArg(arg, to, callee)
+	}
+}
+
+func (v *conversionVisitor) genericCallee(fun ast.Expr) *types.Func {
+	switch fun := fun.(type) {
+	case *ast.Ident:
+		callee, _ := v.info.Uses[fun].(*types.Func)
+		return callee
+	case *ast.SelectorExpr:
+		callee, _ := v.info.Uses[fun.Sel].(*types.Func)
+		return callee
+	}
+	return nil
+}
+
+func (v *conversionVisitor) compositeLit(lit *ast.CompositeLit) {
+	switch t := underlying(v.typeOf(lit)).(type) {
+	case *types.Struct:
+		for i, elt := range lit.Elts {
+			if kv, ok := elt.(*ast.KeyValueExpr); ok {
+				if key, ok := kv.Key.(*ast.Ident); ok {
+					if field, ok := v.info.Uses[key].(*types.Var); ok {
+						v.convert(kv.Value, field.Type())
+					}
+				}
+			} else if i < t.NumFields() {
+				v.convert(elt, t.Field(i).Type())
+			}
+		}
+	case *types.Slice:
+		v.elements(lit, nil, t.Elem())
+	case *types.Array:
+		v.elements(lit, nil, t.Elem())
+	case *types.Map:
+		v.elements(lit, t.Key(), t.Elem())
+	}
+}
+
+func (v *conversionVisitor) elements(lit *ast.CompositeLit, key, elem types.Type) {
+	for _, elt := range lit.Elts {
+		if kv, ok := elt.(*ast.KeyValueExpr); ok {
+			if key != nil {
+				v.convert(kv.Key, key)
+			}
+			elt = kv.Value
+		}
+		v.convert(elt, elem)
+	}
+}
+
+func (v *conversionVisitor) convert(expr ast.Expr, to types.Type) {
+	v.convertArg(expr, to, nil)
+}
+
+func (v *conversionVisitor) convertArg(expr ast.Expr, to types.Type, callee *types.Func) {
+	from := v.typeOf(expr)
+	if from == nil || to == nil {
+		return
+	}
+	if _, ok := from.(*types.Tuple); ok {
+		return
+	}
+	if !types.Identical(from, to) {
+		v.fn(from, to, callee)
+	}
+}
+
+func (v *conversionVisitor) typeOf(expr ast.Expr) types.Type {
+	if tv, ok := v.info.Types[expr]; ok {
+		return tv.Type
+	}
+	return nil
+}
+
+func underlying(t types.Type) types.Type {
+	if t == nil {
+		return nil
+	}
+	return t.Underlying()
+}
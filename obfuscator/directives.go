@@ -0,0 +1,176 @@
+package obfuscator
+
+import (
+	"bytes"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+)
+
+// Source directives which opt code out of obfuscation.
+const (
+	// keepDirective keeps the names of the declarations
+	// that it documents, or of a struct field.
+	keepDirective = "//gobfuscate:keep"
+
+	// noStringsDirective keeps the strings of the function
+	// that it documents, or of a file if it is placed above
+	// the package clause.
+	noStringsDirective = "//gobfuscate:nostrings"
+
+	// ignoreDirective leaves a package alone if it is placed
+	// above the package clause of any of its files.
+	ignoreDirective = "//gobfuscate:ignore"
+)
+
+const directivePrefix = "//gobfuscate:"
+
+// hasDirective checks if a comment group contains a
+// directive.
+func hasDirective(doc *ast.CommentGroup, directive string) bool {
+	if doc == nil {
+		return false
+	}
+	for _, c := range doc.List {
+		if strings.TrimSpace(c.Text) == directive {
+			return true
+		}
+	}
+	return false
+}
+
+// fileHasDirective checks if a directive appears above the
+// package clause of a file.
+func fileHasDirective(file *ast.File, directive string) bool {
+	for _, group := range file.Comments {
+		if group.Pos() < file.Package && hasDirective(group, directive) {
+			return true
+		}
+	}
+	return false
+}
+
+// keepDirectiveDecls finds the names of the declarations in
+// a file which are marked with keepDirective, listing
+// methods as "Receiver.Method" like ignoredDecls.
+func keepDirectiveDecls(file *ast.File) []string {
+	var res []string
+	for _, decl := range file.Decls {
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			if !hasDirective(d.Doc, keepDirective) {
+				continue
+			}
+			if d.Recv == nil {
+				res = append(res, d.Name.Name)
+				continue
+			}
+			for _, rec := range d.Recv.List {
+				if receiver := receiverString(rec); receiver != "" {
+					res = append(res, receiver+"."+d.Name.Name)
+				}
+			}
+		case *ast.GenDecl:
+			all := hasDirective(d.Doc, keepDirective)
+			for _, spec := range d.Specs {
+				switch spec := spec.(type) {
+				case *ast.TypeSpec:
+					if all || hasDirective(spec.Doc, keepDirective) {
+						res = append(res, spec.Name.Name)
+					}
+				case *ast.ValueSpec:
+					if all || hasDirective(spec.Doc, keepDirective) {
+						for _, name := range spec.Names {
+							res = append(res, name.Name)
+						}
+					}
+				}
+			}
+		}
+	}
+	return res
+}
+
+// ignoresPackage checks if any of the files of a package in
+// any workspace are marked with ignoreDirective.
+func (r *Renamer) ignoresPackage(pkgPath string) bool {
+	if r.ignoredPackages == nil {
+		r.ignoredPackages = map[string]bool{}
+		for _, w := range r.workspaces() {
+			for path, pkg := range w.Packages {
+				for _, file := range pkg.Files {
+					if fileHasDirective(file, ignoreDirective) {
+						r.ignoredPackages[path] = true
+					}
+				}
+			}
+		}
+	}
+	return r.ignoredPackages[pkgPath]
+}
+
+// dirHasDirective checks if a directive appears above the
+// package clause of any Go file in a directory.
+func dirHasDirective(dir, directive string) (bool, error) {
+	listing, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return false, err
+	}
+	for _, item := range listing {
+		path := filepath.Join(dir, item.Name())
+		if item.IsDir() || !isGoFile(path) {
+			continue
+		}
+		file, err := parser.ParseFile(token.NewFileSet(), path, nil,
+			parser.PackageClauseOnly|parser.ParseComments)
+		if err != nil {
+			continue
+		}
+		if fileHasDirective(file, directive) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// stripDirectives removes every gobfuscate directive from a
+// Go file, along with the lines that only contain them.
+func stripDirectives(path string) error {
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	set := token.NewFileSet()
+	file, err := parser.ParseFile(set, path, contents, parser.ParseComments)
+	if err != nil {
+		// If the file is invalid, we do nothing.
+		return nil
+	}
+	var edits []edit
+	for _, group := range file.Comments {
+		for _, c := range group.List {
+			if !strings.HasPrefix(c.Text, directivePrefix) {
+				continue
+			}
+			start := set.Position(c.Pos()).Offset
+			end := set.Position(c.End()).Offset
+			lineStart := bytes.LastIndexByte(contents[:start], '\n') + 1
+			lineEnd := len(contents)
+			if idx := bytes.IndexByte(contents[end:], '\n'); idx >= 0 {
+				lineEnd = end + idx + 1
+			}
+			if len(bytes.TrimSpace(contents[lineStart:start])) == 0 &&
+				len(bytes.TrimSpace(contents[end:lineEnd])) == 0 {
+				start, end = lineStart, lineEnd
+			}
+			edits = append(edits, edit{Start: start, End: end})
+		}
+	}
+	if len(edits) == 0 {
+		return nil
+	}
+	return ioutil.WriteFile(path, applyEdits(contents, edits), 0755)
+}
@@ -0,0 +1,148 @@
+package obfuscator
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestStripDirectives(t *testing.T) {
+	dir := writeTestFiles(t, map[string]string{
+		"a.go": `//gobfuscate:nostrings
+
+// Package a is documented.
+package a
+
+//gobfuscate:keep
+func Keep() {}
+
+type T struct {
+	// Name is kept.
+	//gobfuscate:keep
+	Name string
+	Age  int //gobfuscate:keep
+}
+
+// gobfuscate:keep is not a directive.
+func F() string { return "//gobfuscate:keep" }
+`,
+	})
+	path := filepath.Join(dir, "a.go")
+	if err := stripDirectives(path); err != nil {
+		t.Fatal(err)
+	}
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `
+// Package a is documented.
+package a
+
+func Keep() {}
+
+type T struct {
+	// Name is kept.
+	Name string
+	Age  int 
+}
+
+// gobfuscate:keep is not a directive.
+func F() string { return "//gobfuscate:keep" }
+`
+	if string(contents) != expected {
+		t.Errorf("got:\n%s\nexpected:\n%s", contents, expected)
+	}
+}
+
+func TestDirectives(t *testing.T) {
+	dir := writeTestFiles(t, map[string]string{
+		"go.mod": "module example.com/app\n\ngo 1.22\n",
+		"util/util.go": `package util
+
+//gobfuscate:keep
+func Keep() string { return "secret text" }
+
+func Drop() string { return "more secret text" }
+
+type Record struct {
+	//gobfuscate:keep
+	Kept    int
+	Renamed int
+}
+
+//gobfuscate:nostrings
+func Plain() string { return "plain text" }
+`,
+		"util/file.go": `//gobfuscate:nostrings
+
+package util
+
+func File() string { return "file text" }
+`,
+		"ignored/ignored.go": `//gobfuscate:ignore
+
+package ignored
+
+func Hello() string { return "ignored text" }
+`,
+		"cmd/app/main.go": `package main
+
+import (
+	"fmt"
+
+	"example.com/app/ignored"
+	"example.com/app/util"
+)
+
+func main() {
+	r := util.Record{Kept: 1, Renamed: 2}
+	fmt.Println(util.Keep(), util.Drop(), util.Plain(), util.File(), ignored.Hello(), r.Kept+r.Renamed)
+}
+`,
+	})
+	res, output := runObfuscated(t, dir, "example.com/app/cmd/app", Options{})
+	expected := "secret text more secret text plain text file text ignored text 3\n"
+	if output != expected {
+		t.Errorf("got output %q, expected %q", output, expected)
+	}
+
+	renames := testRenames(res)
+	for _, name := range []string{"example.com/app/util.Keep", "example.com/app/util.Record.Kept",
+		"example.com/app/ignored", "example.com/app/ignored.Hello"} {
+		if _, ok := renames[name]; ok {
+			t.Errorf("%s was renamed", name)
+		}
+	}
+	for _, name := range []string{"example.com/app/util.Drop", "example.com/app/util.Record.Renamed",
+		"example.com/app/util.Plain", "example.com/app/util.File"} {
+		if _, ok := renames[name]; !ok {
+			t.Errorf("%s was not renamed", name)
+		}
+	}
+
+	var source strings.Builder
+	err := filepath.Walk(filepath.Join(dir, "obfuscated"), func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() || filepath.Ext(path) != ".go" {
+			return err
+		}
+		contents, err := ioutil.ReadFile(path)
+		source.Write(contents)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, text := range []string{"plain text", "file text", "ignored text"} {
+		if !strings.Contains(source.String(), `"`+text+`"`) {
+			t.Errorf("%q was encrypted", text)
+		}
+	}
+	for _, text := range []string{"secret text", "gobfuscate:"} {
+		if strings.Contains(source.String(), text) {
+			t.Errorf("the output contains %q", text)
+		}
+	}
+}
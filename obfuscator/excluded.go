@@ -0,0 +1,286 @@
+package obfuscator
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+)
+
+// An excludedFile is a Go file of a package which build
+// constraints exclude from every build configuration, so
+// that it is never type-checked.
+type excludedFile struct {
+	Path string
+	Fset *token.FileSet
+	File *ast.File
+}
+
+// excludedFiles parses the excluded files of a package.
+func (r *Renamer) excludedFiles(pkg *WorkspacePackage) ([]*excludedFile, error) {
+	if files, ok := r.excluded[pkg.Build.Dir]; ok {
+		return files, nil
+	}
+	var res []*excludedFile
+	for _, name := range pkg.Build.IgnoredGoFiles {
+		path := filepath.Join(pkg.Build.Dir, name)
+		if r.isChecked(path) {
+			continue
+		}
+		fset := token.NewFileSet()
+		file, err := parser.ParseFile(fset, path, nil, parser.ParseComments)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, &excludedFile{Path: path, Fset: fset, File: file})
+	}
+	r.excluded[pkg.Build.Dir] = res
+	return res, nil
+}
+
+// excludedMembers are the fields and methods which
+// excluded files refer to.
+type excludedMembers struct {
+	// Objects are keyed by the positions of their
+	// declarations, which are the same in every workspace.
+	Objects map[string]string
+
+	// Names are keyed by import path and then by name. They
+	// are the selectors whose types cannot be resolved, and
+	// only cover the package of the file and the workspace
+	// packages which it imports.
+	Names map[string]map[string]string
+}
+
+// reason finds why an excluded file refers to a field or
+// method, or returns "" if none does.
+func (m *excludedMembers) reason(fset *token.FileSet, obj types.Object) string {
+	if reason, ok := m.Objects[fset.Position(obj.Pos()).String()]; ok {
+		return reason
+	}
+	if obj.Pkg() == nil {
+		return ""
+	}
+	return m.Names[obj.Pkg().Path()][obj.Name()]
+}
+
+// excludedUses finds the names which excluded files refer
+// to, since those files cannot be renamed along with the
+// rest of their packages.
+//
+// Top-level names are keyed by import path and then by name
+// like in ignoredDecls. Fields and methods are found by
+// type-checking the excluded files in every workspace.
+func (r *Renamer) excludedUses() (map[string]map[string]string, *excludedMembers, error) {
+	if r.excludedDecls != nil {
+		return r.excludedDecls, r.excludedMembers, nil
+	}
+	const reason = "used by a file excluded by build constraints"
+	decls := map[string]map[string]string{}
+	members := &excludedMembers{
+		Objects: map[string]string{},
+		Names:   map[string]map[string]string{},
+	}
+	addTo := func(m map[string]map[string]string, pkgPath, name string) {
+		if m[pkgPath] == nil {
+			m[pkgPath] = map[string]string{}
+		}
+		m[pkgPath][name] = reason
+	}
+	for _, w := range r.workspaces() {
+		for _, pkg := range w.SortedPackages() {
+			if pkg.XTest {
+				continue
+			}
+			files, info, err := r.checkExcluded(w, pkg)
+			if err != nil {
+				return nil, nil, err
+			}
+			for _, file := range files {
+				name := file.Name.Name
+				imports := map[string]string{}
+				scope := []string{pkg.Build.ImportPath}
+				for _, spec := range file.Imports {
+					path, err := strconv.Unquote(spec.Path.Value)
+					if err != nil {
+						continue
+					}
+					pkgName := r.packageName(path)
+					if pkgName != "" {
+						scope = append(scope, path)
+					}
+					if spec.Name != nil {
+						imports[spec.Name.Name] = path
+					} else if pkgName != "" {
+						imports[pkgName] = path
+					}
+				}
+				addMember := func(obj types.Object, name string) {
+					if obj != nil {
+						if obj.Pkg() != nil && w.Packages[obj.Pkg().Path()] != nil {
+							members.Objects[w.Fset.Position(obj.Pos()).String()] = reason
+						}
+						return
+					}
+					for _, path := range scope {
+						addTo(members.Names, path, name)
+					}
+				}
+				ast.Inspect(file, func(n ast.Node) bool {
+					switch n := n.(type) {
+					case *ast.SelectorExpr:
+						if x, ok := n.X.(*ast.Ident); ok {
+							if path, ok := imports[x.Name]; ok {
+								addTo(decls, path, n.Sel.Name)
+								return false
+							}
+							if _, ok := info.Uses[x].(*types.PkgName); ok {
+								return false
+							}
+						}
+						if sel, ok := info.Selections[n]; ok {
+							addMember(sel.Obj(), n.Sel.Name)
+						} else {
+							addMember(info.Uses[n.Sel], n.Sel.Name)
+						}
+					case *ast.KeyValueExpr:
+						if key, ok := n.Key.(*ast.Ident); ok {
+							if obj, ok := info.Uses[key].(*types.Var); ok && obj.IsField() {
+								addMember(obj, key.Name)
+							} else if info.Uses[key] == nil {
+								addMember(nil, key.Name)
+							}
+						}
+					case *ast.Ident:
+						if name == pkg.Types.Name() {
+							addTo(decls, pkg.Build.ImportPath, n.Name)
+						}
+					}
+					return true
+				})
+			}
+		}
+	}
+	r.excludedDecls = decls
+	r.excludedMembers = members
+	return decls, members, nil
+}
+
+// checkExcluded type-checks the excluded files of a package
+// in a workspace, along with the rest of the package (or
+// on their own for external tests).
+// Type errors are ignored, since the files were not meant
+// for the configuration of the workspace, and the parts
+// that cannot be checked are left out of the info.
+//
+// Programs which are excluded with an "ignore" tag do not
+// use the package's names, so they are left out.
+func (r *Renamer) checkExcluded(w *Workspace, pkg *WorkspacePackage) ([]*ast.File, *types.Info, error) {
+	info := &types.Info{
+		Uses:       map[*ast.Ident]types.Object{},
+		Selections: map[*ast.SelectorExpr]*types.Selection{},
+	}
+	excluded, err := r.excludedFiles(pkg)
+	if err != nil || len(excluded) == 0 {
+		return nil, info, err
+	}
+	var files, internal, external []*ast.File
+	for _, f := range excluded {
+		file, err := parser.ParseFile(w.Fset, f.Path, nil, parser.ParseComments)
+		if err != nil {
+			return nil, nil, err
+		}
+		switch file.Name.Name {
+		case pkg.Types.Name():
+			internal = append(internal, file)
+		case pkg.Types.Name() + "_test":
+			external = append(external, file)
+		default:
+			continue
+		}
+		files = append(files, file)
+	}
+	conf := types.Config{
+		Importer:    w,
+		FakeImportC: true,
+		Error:       func(error) {},
+	}
+	if len(internal) > 0 {
+		conf.Check(pkg.Build.ImportPath, w.Fset, append(append([]*ast.File{}, pkg.Files...),
+			internal...), info)
+	}
+	if len(external) > 0 {
+		conf.Check(pkg.Build.ImportPath+"_test", w.Fset, external, info)
+	}
+	return files, info, nil
+}
+
+// packageName finds the name of a workspace package, or
+// returns "" if it is not in the workspace.
+func (r *Renamer) packageName(pkgPath string) string {
+	for _, w := range r.workspaces() {
+		if pkg, ok := w.Packages[pkgPath]; ok {
+			return pkg.Types.Name()
+		}
+	}
+	return ""
+}
+
+// applyExcluded rewrites the package clauses and imports of
+// the excluded files of a package.
+//
+// Moved packages are imported under their original names,
+// since the rest of an excluded file is left as it is.
+func (r *Renamer) applyExcluded(pkg *WorkspacePackage) error {
+	files, err := r.excludedFiles(pkg)
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		var edits []edit
+		add := func(node ast.Node, text string) {
+			edits = append(edits, edit{
+				Start: f.Fset.Position(node.Pos()).Offset,
+				End:   f.Fset.Position(node.End()).Offset,
+				Text:  text,
+			})
+		}
+		if newPath, ok := r.Packages[pkg.Build.ImportPath]; ok && pkg.Types.Name() != "main" {
+			switch f.File.Name.Name {
+			case pkg.Types.Name():
+				add(f.File.Name, importPathName(newPath))
+			case pkg.Types.Name() + "_test":
+				add(f.File.Name, importPathName(newPath)+"_test")
+			}
+		}
+		for _, spec := range f.File.Imports {
+			path, err := strconv.Unquote(spec.Path.Value)
+			if err != nil {
+				continue
+			}
+			newPath, ok := r.Packages[path]
+			if !ok {
+				continue
+			}
+			if spec.Name != nil {
+				add(spec.Path, strconv.Quote(newPath))
+			} else {
+				add(spec.Path, r.packageName(path)+" "+strconv.Quote(newPath))
+			}
+		}
+		if len(edits) == 0 {
+			continue
+		}
+		contents, err := ioutil.ReadFile(f.Path)
+		if err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(f.Path, applyEdits(contents, edits), 0755); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package obfuscator
+
+import "testing"
+
+func TestExcludedUses(t *testing.T) {
+	dir := writeTestFiles(t, map[string]string{
+		"go.mod": "module example.com/app\n\ngo 1.22\n",
+		"util/util.go": `package util
+
+type File struct{ Level int }
+
+func Open() *File { return &File{} }
+
+func (f *File) Close() error { return nil }
+
+type Conn struct{ Level int }
+
+func (c *Conn) Close() error { return nil }
+`,
+		"plat/plat.go": `package plat
+
+import "example.com/app/util"
+
+func Run() int {
+	c := &util.Conn{Level: 1}
+	c.Close()
+	return c.Level + len(name())
+}
+`,
+		"plat/plat_never.go": `//go:build never
+
+package plat
+
+import "example.com/app/util"
+
+func name() string {
+	f := util.Open()
+	f.Close()
+	_ = util.File{Level: 2}
+	return "never"
+}
+`,
+		"plat/plat_other.go": `//go:build !never
+
+package plat
+
+func name() string { return "other" }
+`,
+		"cmd/app/main.go": `package main
+
+import "example.com/app/plat"
+
+func main() { println(plat.Run()) }
+`,
+	})
+	res := obfuscateTest(t, dir, Options{
+		Targets: []Target{{Package: "example.com/app/cmd/app"}},
+		DryRun:  true,
+	})
+	renames := testRenames(res)
+	for _, name := range []string{"example.com/app/util.(*File).Close", "example.com/app/util.File.Level"} {
+		if _, ok := renames[name]; ok {
+			t.Errorf("%s is used by an excluded file, but it was renamed", name)
+		}
+	}
+	for _, name := range []string{"example.com/app/util.(*Conn).Close", "example.com/app/util.Conn.Level"} {
+		if _, ok := renames[name]; !ok {
+			t.Errorf("%s is not used by an excluded file, but it was kept", name)
+		}
+	}
+}
@@ -0,0 +1,465 @@
+package obfuscator
+
+import (
+	"fmt"
+	"go/ast"
+	"go/types"
+	"sort"
+	"strconv"
+)
+
+// ReflectionSinks are the packages which access struct
+// fields by name through reflection.
+var ReflectionSinks = map[string]bool{
+	"reflect":          true,
+	"encoding/json":    true,
+	"encoding/xml":     true,
+	"encoding/gob":     true,
+	"text/template":    true,
+	"html/template":    true,
+	"net/rpc":          true,
+	"net/rpc/jsonrpc":  true,
+	"log/slog":         true,
+	"gopkg.in/yaml.v2": true,
+	"gopkg.in/yaml.v3": true,
+	"sigs.k8s.io/yaml": true,
+}
+
+// NonRetainingPackages are packages whose functions never
+// pass their interface arguments on to reflection sinks.
+var NonRetainingPackages = map[string]bool{
+	"fmt":    true,
+	"log":    true,
+	"errors": true,
+}
+
+// A reflectedType is a named type which may be reached by
+// reflection sinks.
+type reflectedType struct {
+	// Reason describes the first way the type is reached.
+	Reason string
+
+	// Sinks are all of the sinks which reach the type.
+	Sinks map[string]bool
+}
+
+// fieldRenames finds renames for the fields of the struct
+// types which are declared at the top level of workspace
+// packages.
+//
+// Every field which is left alone is added to r.Skipped:
+// fields with struct tags, fields which may shadow promoted
+// fields or methods, and all fields of struct types which
+// may be reflected upon or which are converted to or from
+// other struct types.
+//
+// If r.InjectTags is set, the fields of struct types which
+// only reach TagEncoders are renamed anyway, and tags with
+// their original names are added to them once every
+// variant has been analyzed.
+func (r *Renamer) fieldRenames(w *Workspace) ([]symbolRenameReq, error) {
+	reflected := reflectedTypes(w)
+	_, excluded, err := r.excludedUses()
+	if err != nil {
+		return nil, err
+	}
+	converted := map[*types.TypeName]string{}
+	for _, pkg := range w.SortedPackages() {
+		conversions(pkg, func(from, to types.Type, _ *types.Func) {
+			_, fromStruct := underlying(from).(*types.Struct)
+			_, toStruct := underlying(to).(*types.Struct)
+			if !fromStruct || !toStruct {
+				return
+			}
+			for _, t := range []types.Type{from, to} {
+				if obj := namedTypeName(t); obj != nil {
+					if _, ok := converted[obj]; !ok {
+						converted[obj] = "converted between " + from.String() + " and " + to.String()
+					}
+				}
+			}
+		})
+	}
+
+	var res []symbolRenameReq
+	for _, pkg := range w.SortedPackages() {
+		ignored, err := r.ignoredDecls(pkg)
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range pkg.Files {
+			if pkg.TestFiles[file] {
+				continue
+			}
+			for _, decl := range file.Decls {
+				d, ok := decl.(*ast.GenDecl)
+				if !ok {
+					continue
+				}
+				for _, spec := range d.Specs {
+					spec, ok := spec.(*ast.TypeSpec)
+					if !ok || spec.Assign.IsValid() || ignored[spec.Name.Name] != "" {
+						continue
+					}
+					structType, ok := spec.Type.(*ast.StructType)
+					obj, isTypeName := pkg.Info.Defs[spec.Name].(*types.TypeName)
+					if !ok || !isTypeName {
+						continue
+					}
+					res = append(res, r.structFieldRenames(w, pkg, obj, structType, converted[obj],
+						reflected[obj], excluded)...)
+				}
+			}
+		}
+	}
+	return res, nil
+}
+
+func (r *Renamer) structFieldRenames(w *Workspace, pkg *WorkspacePackage, obj *types.TypeName,
+	structType *ast.StructType, converted string, reflected *reflectedType,
+	excluded *excludedMembers) []symbolRenameReq {
+	st, ok := obj.Type().Underlying().(*types.Struct)
+	if !ok {
+		return nil
+	}
+	tagKeys, canTag := r.tagKeys(reflected)
+
+	var res []symbolRenameReq
+	for _, field := range structType.Fields.List {
+		for _, name := range field.Names {
+			fieldObj, ok := pkg.Info.Defs[name].(*types.Var)
+			if !ok || name.Name == "_" {
+				continue
+			}
+			r.owners[fieldObj] = obj
+			r.fieldDecls[fieldObj] = field
+
+			reason := r.policyReason(fieldObj)
+			if reason == "" && hasDirective(field.Doc, keepDirective) {
+				reason = "marked with " + keepDirective
+			} else if reason == "" {
+				reason = converted
+			}
+			if reason == "" {
+				reason = excluded.reason(w.Fset, fieldObj)
+			}
+			needsTag := false
+			if reason == "" && reflected != nil {
+				if !canTag {
+					reason = reflected.Reason
+				} else if fieldObj.Exported() {
+					_, reason = injectedTag(field, name.Name, tagKeys)
+					needsTag = true
+				}
+			} else if reason == "" && field.Tag != nil {
+				reason = "has a struct tag"
+			}
+			if reason == "" && shadowsPromoted(st, obj.Pkg(), name.Name) {
+				reason = "shadows a promoted field or method"
+			}
+			if reason != "" {
+				r.Skipped = append(r.Skipped, &Skip{
+					Kind:     KindField,
+					Name:     r.qualifiedName(fieldObj, false),
+					Position: r.objectPosition(fieldObj),
+					Reason:   reason,
+				})
+				continue
+			}
+			if needsTag {
+				r.fieldTags[fieldObj] = tagKeys
+			}
+			res = append(res, symbolRenameReq{fieldObj, hashObject(r.Hasher, fieldObj)})
+		}
+	}
+	return res
+}
+
+// tagKeys finds the struct tag keys which must be injected
+// into the fields of a reflected type, or returns false if
+// tags cannot be injected.
+func (r *Renamer) tagKeys(reflected *reflectedType) ([]string, bool) {
+	if reflected == nil || !r.InjectTags {
+		return nil, false
+	}
+	var res []string
+	for sink := range reflected.Sinks {
+		key, ok := TagEncoders[sink]
+		if !ok {
+			return nil, false
+		}
+		res = append(res, key)
+	}
+	sort.Strings(res)
+	return res, true
+}
+
+// injectedTag creates a tag which keeps the original name
+// of a field for the given keys.
+// It returns the new tag, or a reason why there is none.
+func injectedTag(field *ast.Field, name string, keys []string) (string, string) {
+	if len(field.Names) > 1 {
+		return "", "declared along with other fields, so it cannot be tagged"
+	}
+	if name == "XMLName" {
+		return "", "names an XML element"
+	}
+	var tag string
+	if field.Tag != nil {
+		var err error
+		tag, err = strconv.Unquote(field.Tag.Value)
+		if err != nil {
+			return "", "has a malformed struct tag"
+		}
+	}
+	newTag, err := nameTag(tag, name, keys)
+	if err != nil {
+		return "", "has a malformed struct tag"
+	}
+	return newTag, ""
+}
+
+// shadowsPromoted checks if a field name is also the name
+// of a field or method promoted through an embedded field.
+func shadowsPromoted(st *types.Struct, pkg *types.Package, name string) bool {
+	for i := 0; i < st.NumFields(); i++ {
+		field := st.Field(i)
+		if !field.Embedded() {
+			continue
+		}
+		if obj, _, _ := types.LookupFieldOrMethod(field.Type(), true, pkg, name); obj != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// reflectedTypes finds the named types which may be reached
+// by reflection sinks.
+//
+// Once a value is converted to an interface, it may be
+// handed to any code, so if the program links a sink at
+// all, a type is reached if it is contained in a value
+// which is converted to an interface anywhere. The only
+// exceptions are values which are passed directly to
+// NonRetainingPackages, and values which are passed
+// directly to a sink, which only reach that sink.
+//
+// Sinks which look up methods by name also reach the
+// results of exported methods.
+//
+// Type arguments of generics declared in a sink package
+// are reached too. So are the type arguments of every
+// generic in the workspace, if any generic converts values
+// of its type parameters to interfaces.
+func reflectedTypes(w *Workspace) map[*types.TypeName]*reflectedType {
+	linked := linkedSinks(w)
+	res := map[*types.TypeName]*reflectedType{}
+	if len(linked) == 0 {
+		return res
+	}
+
+	var mark func(t types.Type, sink, reason string, seen map[types.Type]bool)
+	mark = func(t types.Type, sink, reason string, seen map[types.Type]bool) {
+		if seen[t] {
+			return
+		}
+		seen[t] = true
+		switch t := t.(type) {
+		case *types.Alias:
+			mark(types.Unalias(t), sink, reason, seen)
+		case *types.Named:
+			obj := t.Origin().Obj()
+			if res[obj] == nil {
+				res[obj] = &reflectedType{Reason: reason, Sinks: map[string]bool{}}
+			}
+			res[obj].Sinks[sink] = true
+			for i := 0; i < t.TypeArgs().Len(); i++ {
+				mark(t.TypeArgs().At(i), sink, reason, seen)
+			}
+			mark(t.Underlying(), sink, reason, seen)
+			if MethodReflectionSinks[sink] {
+				// The sink may call exported methods and
+				// reflect on what they return.
+				for _, f := range exportedMethods(t) {
+					results := f.Type().(*types.Signature).Results()
+					for i := 0; i < results.Len(); i++ {
+						mark(results.At(i).Type(), sink, reason, seen)
+					}
+				}
+			}
+		case *types.Pointer:
+			mark(t.Elem(), sink, reason, seen)
+		case *types.Slice:
+			mark(t.Elem(), sink, reason, seen)
+		case *types.Array:
+			mark(t.Elem(), sink, reason, seen)
+		case *types.Chan:
+			mark(t.Elem(), sink, reason, seen)
+		case *types.Map:
+			mark(t.Key(), sink, reason, seen)
+			mark(t.Elem(), sink, reason, seen)
+		case *types.Struct:
+			for i := 0; i < t.NumFields(); i++ {
+				mark(t.Field(i).Type(), sink, reason, seen)
+			}
+		}
+	}
+	markAll := func(t types.Type, pkgSinks []string, reason string) {
+		for _, sink := range pkgSinks {
+			mark(t, sink, fmt.Sprintf(reason, sink), map[types.Type]bool{})
+		}
+	}
+
+	paramsConverted := false
+	for _, pkg := range w.SortedPackages() {
+		reason := "converted to an interface in " + pkg.Types.Path() + ", and the program links %s"
+		conversions(pkg, func(from, to types.Type, callee *types.Func) {
+			_, fromParam := types.Unalias(from).(*types.TypeParam)
+			if !types.IsInterface(to) || (types.IsInterface(from) && !fromParam) {
+				return
+			}
+			if callee != nil && callee.Pkg() != nil {
+				calleePath := callee.Pkg().Path()
+				if NonRetainingPackages[calleePath] {
+					return
+				} else if ReflectionSinks[calleePath] {
+					markAll(from, []string{calleePath}, "passed to "+calleePath+"."+callee.Name()+
+						", which reaches %s")
+					return
+				}
+			}
+			if hasTypeParam(from) {
+				paramsConverted = true
+			}
+			markAll(from, linked, reason)
+		})
+	}
+
+	for _, pkg := range w.SortedPackages() {
+		var idents []*ast.Ident
+		for ident := range pkg.Info.Instances {
+			idents = append(idents, ident)
+		}
+		sort.Slice(idents, func(i, j int) bool {
+			return idents[i].Pos() < idents[j].Pos()
+		})
+		for _, ident := range idents {
+			obj := pkg.Info.Uses[ident]
+			if obj == nil {
+				obj = pkg.Info.Defs[ident]
+			}
+			if obj == nil || obj.Pkg() == nil {
+				continue
+			}
+			path := obj.Pkg().Path()
+			name := path + "." + obj.Name()
+			var objSinks []string
+			var reason string
+			if ReflectionSinks[path] {
+				objSinks = []string{path}
+				reason = "type argument of " + name + ", which reaches %s"
+			} else if paramsConverted && w.Packages[path] != nil {
+				objSinks = linked
+				reason = "type argument of " + name + " in a program which converts type parameters " +
+					"to interfaces and links %s"
+			} else {
+				continue
+			}
+			typeArgs := pkg.Info.Instances[ident].TypeArgs
+			for i := 0; i < typeArgs.Len(); i++ {
+				markAll(typeArgs.At(i), objSinks, reason)
+			}
+		}
+	}
+	return res
+}
+
+// exportedMethods finds the exported methods of a named
+// type and of a pointer to it, including promoted methods.
+func exportedMethods(t *types.Named) []*types.Func {
+	var recv types.Type = t
+	if !types.IsInterface(t) {
+		recv = types.NewPointer(t)
+	}
+	var res []*types.Func
+	methods := types.NewMethodSet(recv)
+	for i := 0; i < methods.Len(); i++ {
+		if f, ok := methods.At(i).Obj().(*types.Func); ok && f.Exported() {
+			res = append(res, f)
+		}
+	}
+	return res
+}
+
+// linkedSinks finds the reflection sinks which the program
+// links, in sorted order.
+//
+// The reflect package only counts if the workspace imports
+// it, since packages from the standard library which are
+// not sinks themselves (like fmt) do not use it to look up
+// fields or methods by name.
+func linkedSinks(w *Workspace) []string {
+	linked := map[string]bool{}
+	for _, path := range w.stdDeps {
+		if ReflectionSinks[path] && path != "reflect" {
+			linked[path] = true
+		}
+	}
+	for _, pkg := range w.SortedPackages() {
+		if ReflectionSinks[pkg.Types.Path()] {
+			linked[pkg.Types.Path()] = true
+		}
+		for _, imported := range pkg.Types.Imports() {
+			if ReflectionSinks[imported.Path()] {
+				linked[imported.Path()] = true
+			}
+		}
+	}
+	var res []string
+	for path := range linked {
+		res = append(res, path)
+	}
+	sort.Strings(res)
+	return res
+}
+
+// hasTypeParam checks if a type refers to a type parameter.
+func hasTypeParam(t types.Type) bool {
+	switch t := t.(type) {
+	case *types.TypeParam:
+		return true
+	case *types.Alias:
+		return hasTypeParam(types.Unalias(t))
+	case *types.Named:
+		for i := 0; i < t.TypeArgs().Len(); i++ {
+			if hasTypeParam(t.TypeArgs().At(i)) {
+				return true
+			}
+		}
+	case *types.Pointer:
+		return hasTypeParam(t.Elem())
+	case *types.Slice:
+		return hasTypeParam(t.Elem())
+	case *types.Array:
+		return hasTypeParam(t.Elem())
+	case *types.Chan:
+		return hasTypeParam(t.Elem())
+	case *types.Map:
+		return hasTypeParam(t.Key()) || hasTypeParam(t.Elem())
+	case *types.Struct:
+		for i := 0; i < t.NumFields(); i++ {
+			if hasTypeParam(t.Field(i).Type()) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func namedTypeName(t types.Type) *types.TypeName {
+	if named, ok := types.Unalias(t).(*types.Named); ok {
+		return named.Origin().Obj()
+	}
+	return nil
+}
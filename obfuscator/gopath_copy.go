@@ -1,4 +1,4 @@
-package main
+package obfuscator
 
 import (
 	"fmt"
@@ -11,39 +11,73 @@ import (
 	"golang.org/x/tools/refactor/importgraph"
 )
 
-// CopyGopath creates a new Gopath with a copy of a package
-// and all of its dependencies.
-func CopyGopath(packageName, newGopath string, keepTests bool) error {
-	ctx := build.Default
-
-	rootPkg, err := ctx.Import(packageName, "", 0)
-	if err != nil {
-		return err
+// CopyGopath creates a new Gopath with a copy of some
+// packages and the union of their dependencies.
+//
+// If the go command is in module mode, dependencies are
+// resolved through the current module, and every copied
+// module gets a go.mod in the new GOPATH.
+//
+// Packages and files are copied if they are part of the
+// build for any of the given configurations, or for the
+// default configuration if there are none.
+func CopyGopath(packageNames []string, newGopath string, keepTests bool, configs ...BuildConfig) error {
+	if len(configs) == 0 {
+		configs = []BuildConfig{{}}
 	}
-
-	allDeps, err := findDeps(packageName, &ctx)
-	if err != nil {
-		return err
+	if moduleMode() {
+		return copyModuleDeps(packageNames, newGopath, keepTests, configs)
 	}
 
-	for dep := range allDeps {
-		pkg, err := build.Default.Import(dep, rootPkg.Dir, 0)
-		if err != nil {
-			return err
-		}
-		if pkg.Goroot {
-			continue
-		}
-		if err := copyDep(pkg, newGopath, keepTests); err != nil {
-			return err
+	allDeps := map[string]bool{}
+	for _, config := range configs {
+		ctx := config.context()
+		copied := map[string]bool{}
+		for _, packageName := range packageNames {
+			rootPkg, err := ctx.Import(packageName, "", 0)
+			if err != nil {
+				return err
+			}
+
+			deps, err := findDeps(packageName, &ctx)
+			if err != nil {
+				return err
+			}
+
+			for dep := range deps {
+				if copied[dep] {
+					continue
+				}
+				copied[dep] = true
+				allDeps[dep] = true
+				pkg, err := ctx.Import(dep, rootPkg.Dir, 0)
+				if err != nil {
+					return err
+				}
+				if pkg.Goroot {
+					continue
+				}
+				if err := copyDep(pkg, newGopath, keepTests); err != nil {
+					return err
+				}
+			}
 		}
 	}
 
 	if !keepTests {
-		ctx.GOPATH = newGopath
-		allDeps, err = findDeps(packageName, &ctx)
-		if err != nil {
-			return err
+		allDeps = map[string]bool{}
+		for _, config := range configs {
+			ctx := config.context()
+			ctx.GOPATH = newGopath
+			for _, packageName := range packageNames {
+				deps, err := findDeps(packageName, &ctx)
+				if err != nil {
+					return err
+				}
+				for dep := range deps {
+					allDeps[dep] = true
+				}
+			}
 		}
 	}
 
@@ -88,6 +122,17 @@ func copyDep(pkg *build.Package, newGopath string, keepTests bool) error {
 		srcFiles = append(srcFiles, pkg.TestGoFiles, pkg.XTestGoFiles)
 	}
 
+	// Go files which the build excludes, such as files for
+	// other platforms, are copied as well, so that the new
+	// GOPATH stays complete.
+	var ignored []string
+	for _, file := range pkg.IgnoredGoFiles {
+		if keepTests || !strings.HasSuffix(file, "_test.go") {
+			ignored = append(ignored, file)
+		}
+	}
+	srcFiles = append(srcFiles, ignored)
+
 	for _, list := range srcFiles {
 		for _, file := range list {
 			src := filepath.Join(pkg.Dir, file)
@@ -0,0 +1,53 @@
+package obfuscator
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"go/ast"
+	"strings"
+)
+
+const hashedSymbolSize = 10
+
+// A NameKind is the kind of identifier that is hashed.
+type NameKind string
+
+const (
+	KindPackage NameKind = "package"
+	KindType    NameKind = "type"
+	KindFunc    NameKind = "func"
+	KindMethod  NameKind = "method"
+	KindField   NameKind = "field"
+	KindVar     NameKind = "var"
+	KindConst   NameKind = "const"
+)
+
+// A NameHasher is added to the input of a hash function
+// to make it 'impossible' to find the input value
+type NameHasher []byte
+
+// Hash hashes a token which is declared in the given
+// package as the given kind of name.
+//
+// The hash is an HMAC keyed by the padding, so the same
+// token yields unrelated hashes in different packages and
+// for different kinds of names.
+// The hash is exported if and only if the token is.
+func (n NameHasher) Hash(pkgPath string, kind NameKind, token string) string {
+	mac := hmac.New(sha256.New, n)
+	mac.Write([]byte(pkgPath + "\x00" + string(kind) + "\x00" + token))
+	hashArray := mac.Sum(nil)
+
+	hexStr := strings.ToLower(hex.EncodeToString(hashArray[:hashedSymbolSize]))
+	for i, x := range hexStr {
+		if x >= '0' && x <= '9' {
+			x = 'g' + (x - '0')
+			hexStr = hexStr[:i] + string(x) + hexStr[i+1:]
+		}
+	}
+	if ast.IsExported(token) {
+		hexStr = strings.ToUpper(hexStr[:1]) + hexStr[1:]
+	}
+	return hexStr
+}
@@ -0,0 +1,67 @@
+package obfuscator
+
+import (
+	"go/ast"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestHashSalts(t *testing.T) {
+	n := NameHasher("padding")
+	hashes := map[string]string{}
+	for _, pkgPath := range []string{"example.com/a", "example.com/b", "main"} {
+		for _, kind := range []NameKind{KindType, KindFunc, KindMethod, KindField, KindVar, KindConst} {
+			hash := n.Hash(pkgPath, kind, "Config")
+			if other, ok := hashes[hash]; ok {
+				t.Errorf("Config has the same hash in %s as in %s", pkgPath+" "+string(kind), other)
+			}
+			hashes[hash] = pkgPath + " " + string(kind)
+			if hash != n.Hash(pkgPath, kind, "Config") {
+				t.Errorf("the hash of Config in %s %s is not deterministic", pkgPath, kind)
+			}
+		}
+	}
+	if NameHasher("other").Hash("main", KindFunc, "run") == n.Hash("main", KindFunc, "run") {
+		t.Error("different paddings give the same hash")
+	}
+}
+
+func TestHashIdentifiers(t *testing.T) {
+	n := NameHasher("padding")
+	ident := regexp.MustCompile(`^[a-z]{20}$`)
+	for _, token := range []string{"run", "Run", "_x", "ünïcode", "Ünïcode"} {
+		hash := n.Hash("main", KindFunc, token)
+		if !ident.MatchString(strings.ToLower(hash)) {
+			t.Errorf("hash %q of %q is not made of %d letters", hash, token, 2*hashedSymbolSize)
+		}
+		if ast.IsExported(hash) != ast.IsExported(token) {
+			t.Errorf("hash %q of %q does not preserve whether it is exported", hash, token)
+		}
+	}
+}
+
+func TestEncryptComponents(t *testing.T) {
+	n := NameHasher("padding")
+	a := strings.Split(encryptComponents("github.com/a/util", "github.com/a", n, nil, true), "/")
+	b := strings.Split(encryptComponents("github.com/b/util", "github.com/b", n, nil, true), "/")
+	if a[0] == b[0] || a[2] == b[2] {
+		t.Errorf("modules share hashed components: %v and %v", a, b)
+	}
+	if !strings.HasSuffix(a[0], hashedDomainSuffix) || strings.ToLower(a[0]) != a[0] {
+		t.Errorf("first component %q is not a lowercase domain", a[0])
+	}
+	if c := strings.Split(encryptComponents("github.com/a/cmd", "github.com/a", n, nil, true), "/"); c[0] != a[0] ||
+		c[1] != a[1] {
+		t.Errorf("packages of one module do not share their module path: %v and %v", a, c)
+	}
+	if plain := encryptComponents("lib/util", "lib", n, nil, false); strings.Contains(plain, ".") {
+		t.Errorf("got a dot in %q", plain)
+	}
+
+	keep := func(dir string) bool { return dir == "github.com" }
+	if kept := encryptComponents("github.com/a/util", "github.com/a", n, keep, true); !strings.HasPrefix(kept,
+		"github.com/") {
+		t.Errorf("kept components were hashed: %q", kept)
+	}
+}
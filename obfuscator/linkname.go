@@ -0,0 +1,240 @@
+package obfuscator
+
+import (
+	"go/ast"
+	"go/types"
+	"strings"
+)
+
+// A Linkname records a //go:linkname directive which was
+// rewritten to use the new names of its declaration and
+// symbol.
+type Linkname struct {
+	Position string `json:"position"`
+	Old      string `json:"old"`
+	New      string `json:"new"`
+}
+
+// A linkname is a parsed //go:linkname directive.
+type linkname struct {
+	Comment *ast.Comment
+	Local   string
+
+	// Remote is the linker symbol, such as "runtime.nanotime"
+	// or "example.com/pkg.(*T).Method", or "" if the directive
+	// only names the local declaration.
+	Remote string
+}
+
+// fileLinknames finds the //go:linkname directives in a
+// file.
+func fileLinknames(file *ast.File) []linkname {
+	var res []linkname
+	for _, group := range file.Comments {
+		for _, c := range group.List {
+			fields := strings.Fields(c.Text)
+			if len(fields) < 2 || len(fields) > 3 || fields[0] != "//go:linkname" {
+				continue
+			}
+			l := linkname{Comment: c, Local: fields[1]}
+			if len(fields) == 3 {
+				l.Remote = fields[2]
+			}
+			res = append(res, l)
+		}
+	}
+	return res
+}
+
+// splitLinkSymbol splits a linker symbol into an import
+// path and a name, which is listed as "Receiver.Method"
+// for methods, like in ignoredDecls.
+func splitLinkSymbol(symbol string) (pkgPath, name string, ok bool) {
+	slash := strings.LastIndex(symbol, "/")
+	dot := strings.Index(symbol[slash+1:], ".")
+	if dot < 0 {
+		return "", "", false
+	}
+	dot += slash + 1
+	// The linker escapes dots in the last path element.
+	pkgPath = strings.Replace(symbol[:dot], "%2e", ".", -1)
+	return pkgPath, symbol[dot+1:], true
+}
+
+// linkSymbolPath escapes the dots in the last element of an
+// import path, as the linker does in symbol names.
+func linkSymbolPath(pkgPath string) string {
+	slash := strings.LastIndex(pkgPath, "/")
+	return pkgPath[:slash+1] + strings.Replace(pkgPath[slash+1:], ".", "%2e", -1)
+}
+
+// linknameIgnoredDecls finds the declarations which
+// //go:linkname directives refer to in ways that cannot be
+// rewritten, keyed by import path and then by name like in
+// ignoredDecls.
+//
+// These are the declarations marked by a directive without
+// a symbol, which any package may refer to by name, and
+// the symbols named by directives in files which are not
+// type-checked in any workspace.
+func (r *Renamer) linknameIgnoredDecls() (map[string]map[string]string, error) {
+	if r.linknameIgnored != nil {
+		return r.linknameIgnored, nil
+	}
+	res := map[string]map[string]string{}
+	add := func(pkgPath, name, reason string) {
+		if res[pkgPath] == nil {
+			res[pkgPath] = map[string]string{}
+		}
+		if _, ok := res[pkgPath][name]; !ok {
+			res[pkgPath][name] = reason
+		}
+	}
+	seenDirs := map[string]bool{}
+	for _, w := range r.workspaces() {
+		for _, pkg := range w.SortedPackages() {
+			for _, file := range pkg.Files {
+				for _, l := range fileLinknames(file) {
+					if l.Remote == "" {
+						add(pkg.Build.ImportPath, l.Local,
+							"marked by //go:linkname, so other packages may refer to it by its symbol name")
+					}
+				}
+			}
+			if seenDirs[pkg.Build.Dir] {
+				continue
+			}
+			seenDirs[pkg.Build.Dir] = true
+			files, err := r.excludedFiles(pkg)
+			if err != nil {
+				return nil, err
+			}
+			for _, f := range files {
+				for _, l := range fileLinknames(f.File) {
+					if pkgPath, name, ok := splitLinkSymbol(l.Remote); ok && r.isWorkspacePackage(pkgPath) {
+						add(pkgPath, name, "referred to by //go:linkname in a file excluded by build constraints")
+					}
+				}
+			}
+		}
+	}
+	r.linknameIgnored = res
+	return res, nil
+}
+
+// rewriteLinknames computes the new text of every
+// //go:linkname directive affected by the pending renames,
+// and records the rewrites in r.Linknames.
+//
+// The local name of a directive is rewritten along with its
+// declaration, and the symbol is rewritten if it belongs to
+// a package in the workspace.
+func (r *Renamer) rewriteLinknames() {
+	seen := map[string]bool{}
+	for _, w := range r.workspaces() {
+		for _, pkg := range w.SortedPackages() {
+			for _, file := range pkg.Files {
+				for _, l := range fileLinknames(file) {
+					text := r.linknameText(pkg, l)
+					if text == l.Comment.Text {
+						continue
+					}
+					r.linknameEdits[l.Comment] = text
+					position := r.position(l.Comment.Pos())
+					if !seen[position] {
+						seen[position] = true
+						r.Linknames = append(r.Linknames, &Linkname{
+							Position: position,
+							Old:      l.Comment.Text,
+							New:      text,
+						})
+					}
+				}
+			}
+		}
+	}
+}
+
+func (r *Renamer) linknameText(pkg *WorkspacePackage, l linkname) string {
+	local := l.Local
+	if obj := pkg.Types.Scope().Lookup(local); obj != nil {
+		if newName, ok := r.newName(obj); ok {
+			local = newName
+		}
+	}
+	if l.Remote == "" {
+		return "//go:linkname " + local
+	}
+	remote := l.Remote
+	if pkgPath, name, ok := splitLinkSymbol(l.Remote); ok && r.isWorkspacePackage(pkgPath) {
+		prefix := l.Remote[:len(l.Remote)-len(name)-1]
+		if newPath, ok := r.Packages[pkgPath]; ok {
+			prefix = linkSymbolPath(newPath)
+		}
+		if newName, ok := r.linkSymbolName(pkgPath, name); ok {
+			name = newName
+		}
+		remote = prefix + "." + name
+	}
+	return "//go:linkname " + local + " " + remote
+}
+
+// linkSymbolName finds the new name of a top-level symbol
+// or a method, listed as "T.Method" or "(*T).Method", in any
+// of the workspaces.
+//
+// If a method's receiver type is renamed but the method is
+// not (or vice versa), the unchanged part is kept.
+func (r *Renamer) linkSymbolName(pkgPath, name string) (string, bool) {
+	dot := strings.LastIndex(name, ".")
+	if dot < 0 {
+		return r.asmSymbolName(pkgPath, name)
+	}
+	recv, method := name[:dot], name[dot+1:]
+	ptr := strings.HasPrefix(recv, "(*") && strings.HasSuffix(recv, ")")
+	if ptr {
+		recv = recv[2 : len(recv)-1]
+	}
+	for _, w := range r.workspaces() {
+		pkg, ok := w.Packages[pkgPath]
+		if !ok {
+			continue
+		}
+		typeName, ok := pkg.Types.Scope().Lookup(recv).(*types.TypeName)
+		if !ok {
+			continue
+		}
+		obj, _, _ := types.LookupFieldOrMethod(typeName.Type(), ptr, pkg.Types, method)
+		f, ok := obj.(*types.Func)
+		if !ok {
+			continue
+		}
+		newRecv, recvRenamed := r.newName(typeName)
+		newMethod, methodRenamed := r.newName(f)
+		if !recvRenamed && !methodRenamed {
+			return "", false
+		}
+		if !recvRenamed {
+			newRecv = recv
+		}
+		if !methodRenamed {
+			newMethod = method
+		}
+		if ptr {
+			newRecv = "(*" + newRecv + ")"
+		}
+		return newRecv + "." + newMethod, true
+	}
+	return "", false
+}
+
+// isWorkspacePackage checks if an import path belongs to a
+// package in any of the workspaces.
+func (r *Renamer) isWorkspacePackage(pkgPath string) bool {
+	for _, w := range r.workspaces() {
+		if _, ok := w.Packages[pkgPath]; ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,106 @@
+package obfuscator
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLinkSymbols(t *testing.T) {
+	tests := []struct {
+		symbol string
+		path   string
+		name   string
+	}{
+		{"runtime.nanotime", "runtime", "nanotime"},
+		{"example.com/a/b.Func", "example.com/a/b", "Func"},
+		{"example.com/a/b.(*T).Method", "example.com/a/b", "(*T).Method"},
+		{"gopkg.in/yaml%2ev3.Unmarshal", "gopkg.in/yaml.v3", "Unmarshal"},
+		{"hash%2einvalid.Func", "hash.invalid", "Func"},
+	}
+	for _, test := range tests {
+		path, name, ok := splitLinkSymbol(test.symbol)
+		if !ok || path != test.path || name != test.name {
+			t.Errorf("splitLinkSymbol(%q) = %q, %q, %v", test.symbol, path, name, ok)
+			continue
+		}
+		if symbol := linkSymbolPath(path) + "." + name; symbol != test.symbol {
+			t.Errorf("linker symbol of %q and %q is %q, expected %q", path, name, symbol, test.symbol)
+		}
+	}
+	if _, _, ok := splitLinkSymbol("example.com/nodot"); ok {
+		t.Error("expected a symbol without a name to be rejected")
+	}
+}
+
+func TestLinknames(t *testing.T) {
+	dir := writeTestFiles(t, map[string]string{
+		"go.mod": "module example.com/app\n\ngo 1.22\n",
+		"secret/secret.go": `package secret
+
+import _ "unsafe"
+
+func secret() string { return "pulled" }
+
+type counter struct{ n int }
+
+func (c *counter) next() int { c.n++; return c.n }
+
+//go:linkname pushed example.com/app/linked.pushed
+func pushed() string { return "pushed" }
+`,
+		"linked/linked.go": `package linked
+
+import (
+	_ "unsafe"
+
+	_ "example.com/app/secret"
+)
+
+//go:linkname pulled example.com/app/secret.secret
+func pulled() string
+
+type counter struct{ n int }
+
+//go:linkname next example.com/app/secret.(*counter).next
+func next(c *counter) int
+
+func pushed() string
+
+func Values() (string, string, int) {
+	c := &counter{n: 4}
+	return pulled(), pushed(), next(c)
+}
+`,
+		"linked/linked.s": "",
+		"cmd/app/main.go": `package main
+
+import (
+	"fmt"
+
+	"example.com/app/linked"
+)
+
+func main() { fmt.Println(linked.Values()) }
+`,
+	})
+	res, output := runObfuscated(t, dir, "example.com/app/cmd/app", Options{})
+	if expected := "pulled pushed 5\n"; output != expected {
+		t.Errorf("got output %q, expected %q", output, expected)
+	}
+
+	renames := testRenames(res)
+	for _, name := range []string{"example.com/app/secret.secret", "example.com/app/secret.(*counter).next",
+		"example.com/app/secret.pushed", "example.com/app/linked.pulled"} {
+		if _, ok := renames[name]; !ok {
+			t.Errorf("%s was not renamed", name)
+		}
+	}
+	if len(res.Linknames) != 3 {
+		t.Fatalf("expected 3 rewritten directives, got %d", len(res.Linknames))
+	}
+	for _, l := range res.Linknames {
+		if strings.Contains(l.New, "example.com") || strings.Contains(l.New, "secret") {
+			t.Errorf("directive %q was rewritten to %q, which leaks a name", l.Old, l.New)
+		}
+	}
+}
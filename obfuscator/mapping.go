@@ -0,0 +1,307 @@
+package obfuscator
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go/token"
+	"go/types"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// encryptedMappingMagic starts every encrypted mapping
+// file, so that it can be told apart from plain JSON.
+const encryptedMappingMagic = "GOBFENC1"
+
+// A Mapping records every package move and symbol rename
+// performed by an obfuscation run.
+type Mapping struct {
+	Entries []*MappingEntry `json:"entries"`
+}
+
+// A MappingEntry records a single obfuscated name.
+//
+// Symbols are qualified the same way that the runtime
+// prints them in stack traces, such as "pkg/path.Func" or
+// "pkg/path.(*Type).Method". Fields are qualified like
+// "pkg/path.Type.Field". Obfuscated symbols from main
+// packages are qualified with "main".
+type MappingEntry struct {
+	Kind       NameKind `json:"kind"`
+	Original   string   `json:"original"`
+	Obfuscated string   `json:"obfuscated"`
+
+	// Position is the position of the declaration in the
+	// original source, relative to the GOPATH (or module
+	// cache) it was copied from.
+	Position string `json:"position,omitempty"`
+}
+
+// Mapping creates a Mapping for every pending package move
+// and symbol rename.
+func (r *Renamer) Mapping() *Mapping {
+	m := &Mapping{}
+	for oldPath, newPath := range r.Packages {
+		m.Entries = append(m.Entries, &MappingEntry{
+			Kind:       KindPackage,
+			Original:   oldPath,
+			Obfuscated: newPath,
+		})
+	}
+	declared := map[string]bool{}
+	for obj := range r.Objects {
+		// Declarations shared by several variants of the
+		// workspace are only listed once.
+		if key := r.declKey(obj); !declared[key] {
+			declared[key] = true
+			m.Entries = append(m.Entries, &MappingEntry{
+				Kind:       objectKind(obj),
+				Original:   r.qualifiedName(obj, false),
+				Obfuscated: r.qualifiedName(obj, true),
+				Position:   r.objectPosition(obj),
+			})
+		}
+	}
+	if r.imported != nil {
+		// Keep the imported names that were not used in this
+		// run, so that the mapping can be passed on to the
+		// next build which shares them.
+		seen := map[string]bool{}
+		for _, entry := range m.Entries {
+			seen[entry.key()] = true
+		}
+		for _, entry := range r.imported.Entries {
+			if !seen[entry.key()] {
+				m.Entries = append(m.Entries, entry)
+			}
+		}
+	}
+	sort.Slice(m.Entries, func(i, j int) bool {
+		e1, e2 := m.Entries[i], m.Entries[j]
+		if e1.Kind != e2.Kind {
+			return e1.Kind < e2.Kind
+		}
+		return e1.Original < e2.Original
+	})
+	return m
+}
+
+// Import reuses the names from a previous mapping for every
+// package and symbol that it covers, so that the same names
+// are produced for code shared by several builds.
+// It must be called before adding any renames.
+//
+// Packages which are not in the mapping are still moved
+// into the directories of their imported parents.
+func (r *Renamer) Import(m *Mapping) {
+	r.imported = m
+	r.importedPaths = map[string]string{}
+	r.importedSymbols = map[string]string{}
+	for _, entry := range m.Entries {
+		if entry.Kind != KindPackage {
+			r.importedSymbols[entry.key()] = lastIdentifier(entry.Obfuscated)
+			continue
+		}
+		comps := strings.Split(entry.Original, "/")
+		newComps := strings.Split(entry.Obfuscated, "/")
+		if len(comps) != len(newComps) {
+			continue
+		}
+		for i := range comps {
+			prefix := strings.Join(comps[:i+1], "/")
+			r.importedPaths[prefix] = strings.Join(newComps[:i+1], "/")
+		}
+	}
+}
+
+// importedPath replaces the longest prefix of an import
+// path which was moved by an imported mapping.
+func (r *Renamer) importedPath(path, newPath string) string {
+	comps := strings.Split(path, "/")
+	newComps := strings.Split(newPath, "/")
+	for i := len(comps); i > 0; i-- {
+		if prefix, ok := r.importedPaths[strings.Join(comps[:i], "/")]; ok {
+			return strings.Join(append([]string{prefix}, newComps[i:]...), "/")
+		}
+	}
+	return newPath
+}
+
+// importedName finds the name of an object in an imported
+// mapping.
+func (r *Renamer) importedName(obj types.Object) (string, bool) {
+	name, ok := r.importedSymbols[string(objectKind(obj))+" "+r.qualifiedName(obj, false)]
+	return name, ok && name != ""
+}
+
+// qualifiedName gets the runtime name of an object, either
+// before or after renaming.
+func (r *Renamer) qualifiedName(obj types.Object, renamed bool) string {
+	name := func(obj types.Object) string {
+		if renamed {
+			if newName, ok := r.newName(obj); ok {
+				return newName
+			}
+		}
+		return obj.Name()
+	}
+	pkgPath := obj.Pkg().Path()
+	if renamed {
+		if obj.Pkg().Name() == "main" {
+			pkgPath = "main"
+		} else if newPath, ok := r.Packages[pkgPath]; ok {
+			pkgPath = newPath
+		}
+	}
+
+	if field, ok := obj.(*types.Var); ok && field.IsField() {
+		if owner, ok := r.owners[field]; ok {
+			return pkgPath + "." + name(owner) + "." + name(obj)
+		}
+	}
+	if fn, ok := obj.(*types.Func); ok {
+		if recv := fn.Type().(*types.Signature).Recv(); recv != nil {
+			recvType := recv.Type()
+			ptr, isPtr := recvType.(*types.Pointer)
+			if isPtr {
+				recvType = ptr.Elem()
+			}
+			recvName := "?"
+			if named, ok := recvType.(*types.Named); ok {
+				recvName = name(named.Obj())
+				if named.TypeParams().Len() > 0 {
+					recvName += "[...]"
+				}
+			}
+			if isPtr {
+				return pkgPath + ".(*" + recvName + ")." + name(obj)
+			}
+			return pkgPath + "." + recvName + "." + name(obj)
+		}
+	}
+	return pkgPath + "." + name(obj)
+}
+
+func (e *MappingEntry) key() string {
+	return string(e.Kind) + " " + e.Original
+}
+
+func lastIdentifier(qualified string) string {
+	idents := symbolizeTokenExpr.FindAllString(qualified, -1)
+	if len(idents) == 0 {
+		return ""
+	}
+	return idents[len(idents)-1]
+}
+
+func (r *Renamer) objectPosition(obj types.Object) string {
+	return r.position(obj.Pos())
+}
+
+// position formats a position relative to the src
+// directory of the GOPATH.
+func (r *Renamer) position(p token.Pos) string {
+	return srcPosition(r.Workspace.Gopath, r.Workspace.Fset.Position(p))
+}
+
+func srcPosition(gopath string, pos token.Position) string {
+	srcDir := filepath.Join(gopath, "src")
+	if rel, err := filepath.Rel(srcDir, pos.Filename); err == nil {
+		pos.Filename = filepath.ToSlash(rel)
+	}
+	return pos.String()
+}
+
+// WriteMapping saves a mapping as JSON.
+// If key is non-nil, the JSON is encrypted with the key
+// using AES-GCM.
+func WriteMapping(path string, m *Mapping, key []byte) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	if key != nil {
+		data, err = sealMapping(data, key)
+		if err != nil {
+			return err
+		}
+	}
+	return ioutil.WriteFile(path, data, 0600)
+}
+
+// ReadMapping loads a mapping saved by WriteMapping.
+// The key is only used for encrypted mappings.
+func ReadMapping(path string, key []byte) (*Mapping, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if bytes.HasPrefix(data, []byte(encryptedMappingMagic)) {
+		if key == nil {
+			return nil, errors.New("mapping is encrypted, but no padding was provided")
+		}
+		data, err = openMapping(data, key)
+		if err != nil {
+			return nil, err
+		}
+	}
+	var m Mapping
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("parse mapping: %s", err)
+	}
+	return &m, nil
+}
+
+// MappingKey derives a key for encrypting mappings from
+// the padding.
+func MappingKey(n NameHasher) []byte {
+	mac := hmac.New(sha256.New, n)
+	mac.Write([]byte("gobfuscate mapping key"))
+	return mac.Sum(nil)
+}
+
+func sealMapping(data, key []byte) ([]byte, error) {
+	aead, err := mappingCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	res := append([]byte(encryptedMappingMagic), nonce...)
+	return aead.Seal(res, nonce, data, nil), nil
+}
+
+func openMapping(data, key []byte) ([]byte, error) {
+	aead, err := mappingCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	data = data[len(encryptedMappingMagic):]
+	if len(data) < aead.NonceSize() {
+		return nil, errors.New("encrypted mapping is truncated")
+	}
+	res, err := aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], nil)
+	if err != nil {
+		return nil, errors.New("decrypt mapping: wrong padding or corrupted file")
+	}
+	return res, nil
+}
+
+func mappingCipher(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,147 @@
+package obfuscator
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestMappingFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gobfuscate_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	m := &Mapping{
+		Entries: []*MappingEntry{
+			{Kind: KindPackage, Original: "example.com/a", Obfuscated: "aaaa.invalid/bbbb"},
+			{Kind: KindFunc, Original: "example.com/a.F", Obfuscated: "aaaa.invalid/bbbb.Cccc",
+				Position: "example.com/a/a.go:3:6"},
+		},
+	}
+	key := MappingKey(NameHasher("padding"))
+	for _, key := range [][]byte{nil, key} {
+		path := filepath.Join(dir, "mapping.json")
+		if err := WriteMapping(path, m, key); err != nil {
+			t.Fatal(err)
+		}
+		actual, err := ReadMapping(path, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(actual, m) {
+			t.Errorf("mapping changed in a round trip with key %x", key)
+		}
+	}
+
+	path := filepath.Join(dir, "mapping.json")
+	if _, err := ReadMapping(path, nil); err == nil {
+		t.Error("expected an error for an encrypted mapping without a key")
+	}
+	if _, err := ReadMapping(path, MappingKey(NameHasher("wrong"))); err == nil {
+		t.Error("expected an error for the wrong key")
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, data[:len(encryptedMappingMagic)+4], 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadMapping(path, key); err == nil {
+		t.Error("expected an error for a truncated mapping")
+	}
+}
+
+func TestImportMapping(t *testing.T) {
+	dir := writeTestFiles(t, map[string]string{
+		"go.mod": "module example.com/app\n\ngo 1.22\n",
+		"shared/shared.go": `package shared
+
+type Message struct{ Body string }
+
+func (m *Message) Send() string { return m.Body }
+
+func Removed() {}
+`,
+		"cmd/app/main.go": `package main
+
+import "example.com/app/shared"
+
+func main() {
+	shared.Removed()
+	println((&shared.Message{Body: "hi"}).Send())
+}
+`,
+	})
+	first := obfuscateTest(t, dir, Options{
+		Targets: []Target{{Package: "example.com/app/cmd/app"}},
+		DryRun:  true,
+		Padding: NameHasher("first"),
+	})
+
+	// The mapping goes through an encrypted file, as it does
+	// with -encryptmapping and -importmapping.
+	key := MappingKey(NameHasher("first"))
+	path := filepath.Join(dir, "mapping.json")
+	if err := WriteMapping(path, first.Mapping, key); err != nil {
+		t.Fatal(err)
+	}
+	imported, err := ReadMapping(path, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The next build drops a function and adds another.
+	files := map[string]string{
+		"shared/shared.go": `package shared
+
+type Message struct{ Body string }
+
+func (m *Message) Send() string { return m.Body }
+
+func Added() {}
+`,
+		"cmd/app/main.go": `package main
+
+import "example.com/app/shared"
+
+func main() {
+	shared.Added()
+	println((&shared.Message{Body: "hi"}).Send())
+}
+`,
+	}
+	for name, contents := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, filepath.FromSlash(name)), []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	second := obfuscateTest(t, dir, Options{
+		Targets:       []Target{{Package: "example.com/app/cmd/app"}},
+		DryRun:        true,
+		Padding:       NameHasher("second"),
+		ImportMapping: imported,
+	})
+
+	firstRenames := testRenames(first)
+	secondRenames := testRenames(second)
+	for _, name := range []string{"example.com/app/shared", "example.com/app/shared.Message",
+		"example.com/app/shared.(*Message).Send", "example.com/app/shared.Message.Body",
+		"example.com/app/shared.Removed"} {
+		if firstRenames[name] == "" || secondRenames[name] != firstRenames[name] {
+			t.Errorf("%s was renamed to %q, then to %q", name, firstRenames[name], secondRenames[name])
+		}
+	}
+	added := secondRenames["example.com/app/shared.Added"]
+	if added == "" {
+		t.Fatal("a new function was not renamed")
+	}
+	expected := NameHasher("second").Hash("example.com/app/shared", KindFunc, "Added")
+	if lastIdentifier(added) != expected {
+		t.Errorf("a new function was renamed to %s, expected %s", added, expected)
+	}
+}
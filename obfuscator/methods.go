@@ -0,0 +1,435 @@
+package obfuscator
+
+import (
+	"go/ast"
+	"go/types"
+	"sort"
+)
+
+// StdDynamicMethods are the names of methods which the
+// standard library looks for through interfaces that are
+// missing from its export data, such as the anonymous
+// interface{ Unwrap() error } in package errors.
+var StdDynamicMethods = map[string]bool{
+	"Unwrap":     true,
+	"Is":         true,
+	"As":         true,
+	"Timeout":    true,
+	"Temporary":  true,
+	"CloseRead":  true,
+	"CloseWrite": true,
+}
+
+// MethodReflectionSinks are the reflection sinks which look
+// up exported methods by name.
+var MethodReflectionSinks = map[string]bool{
+	"reflect":         true,
+	"text/template":   true,
+	"html/template":   true,
+	"net/rpc":         true,
+	"net/rpc/jsonrpc": true,
+}
+
+// methodRenames finds renames for the methods declared in
+// the workspace, including the methods of interfaces.
+//
+// Methods are grouped with the methods of the interfaces
+// that their types implement and of the constraints that
+// their types are used with, and every method in a group
+// gets the same name.
+// Groups which include a method that cannot be renamed,
+// such as a method of a standard library interface, are
+// left alone and added to r.Skipped.
+func (r *Renamer) methodRenames() ([]symbolRenameReq, error) {
+	groups := &methodGroups{parent: map[*types.Func]*types.Func{}}
+	declared, pinned, err := r.declaredMethods(groups)
+	if err != nil {
+		return nil, err
+	}
+	for _, w := range r.workspaces() {
+		groupImplementations(w, groups)
+		groupConstraints(w, groups)
+	}
+
+	// Every group is pinned by the first method in it which
+	// cannot be renamed, if there is one.
+	pins := map[*types.Func]*types.Func{}
+	for _, f := range groups.order {
+		root := groups.find(f)
+		if _, ok := pins[root]; ok {
+			continue
+		}
+		if _, ok := pinned[f]; ok || !declared[f] {
+			pins[root] = f
+		}
+	}
+
+	groupNames := map[*types.Func]string{}
+	groupPaths := map[*types.Func]string{}
+	for _, f := range groups.order {
+		root := groups.find(f)
+		if !declared[f] {
+			continue
+		}
+		if name, ok := r.importedName(f); ok && groupNames[root] == "" {
+			groupNames[root] = name
+		}
+		if path, ok := groupPaths[root]; !ok || f.Pkg().Path() < path {
+			groupPaths[root] = f.Pkg().Path()
+		}
+	}
+
+	var res []symbolRenameReq
+	for _, f := range groups.order {
+		if !declared[f] {
+			continue
+		}
+		root := groups.find(f)
+		if pin, ok := pins[root]; ok {
+			reason, ok := pinned[f]
+			if !ok {
+				reason = "must keep the same name as " + r.methodName(pin)
+			}
+			r.Skipped = append(r.Skipped, &Skip{
+				Kind:     KindMethod,
+				Name:     r.qualifiedName(f, false),
+				Position: r.objectPosition(f),
+				Reason:   reason,
+			})
+			continue
+		}
+		name := groupNames[root]
+		if name == "" {
+			name = r.Hasher.Hash(groupPaths[root], KindMethod, f.Name())
+		}
+		res = append(res, symbolRenameReq{f, name})
+	}
+	return res, nil
+}
+
+// declaredMethods adds every method declared in the
+// workspace and its variants to groups, and finds the
+// reasons that some of them cannot be renamed.
+//
+// Methods which are declared in several workspaces are
+// grouped with each other.
+func (r *Renamer) declaredMethods(groups *methodGroups) (map[*types.Func]bool,
+	map[*types.Func]string, error) {
+	declared := map[*types.Func]bool{}
+	pinned := map[*types.Func]string{}
+	byKey := map[string]*types.Func{}
+	for _, w := range r.workspaces() {
+		if err := r.addDeclaredMethods(w, groups, declared, pinned, byKey); err != nil {
+			return nil, nil, err
+		}
+	}
+	return declared, pinned, nil
+}
+
+func (r *Renamer) addDeclaredMethods(w *Workspace, groups *methodGroups, declared map[*types.Func]bool,
+	pinned map[*types.Func]string, byKey map[string]*types.Func) error {
+	reflected := reflectedTypes(w)
+	_, excluded, err := r.excludedUses()
+	if err != nil {
+		return err
+	}
+	for _, pkg := range w.SortedPackages() {
+		ignored, err := r.ignoredDecls(pkg)
+		if err != nil {
+			return err
+		}
+		add := func(name *ast.Ident, recv *ast.FieldList) {
+			f, ok := pkg.Info.Defs[name].(*types.Func)
+			if !ok || name.Name == "_" {
+				return
+			}
+			groups.add(f)
+			declared[f] = true
+			if reason := r.policyReason(f); reason != "" {
+				pinned[f] = reason
+			} else if reason := methodPinReason(f, recv, ignored, reflected); reason != "" {
+				pinned[f] = reason
+			} else if reason := excluded.reason(w.Fset, f); reason != "" {
+				pinned[f] = reason
+			}
+			key := r.declKey(f)
+			if other, ok := byKey[key]; ok {
+				groups.union(other, f)
+			} else {
+				byKey[key] = f
+			}
+		}
+		for _, file := range pkg.Files {
+			ast.Inspect(file, func(n ast.Node) bool {
+				switch n := n.(type) {
+				case *ast.FuncDecl:
+					if n.Recv != nil {
+						add(n.Name, n.Recv)
+					}
+				case *ast.InterfaceType:
+					for _, field := range n.Methods.List {
+						for _, name := range field.Names {
+							add(name, nil)
+						}
+					}
+				}
+				return true
+			})
+		}
+	}
+	return nil
+}
+
+// methodPinReason finds the reason that a method declared in
+// the workspace cannot be renamed, or returns "".
+//
+// The recv argument is nil for interface methods.
+func methodPinReason(f *types.Func, recv *ast.FieldList, ignored map[string]string,
+	reflected map[*types.TypeName]*reflectedType) string {
+	if StdDynamicMethods[f.Name()] {
+		return "may be called by the standard library through an unexported interface"
+	}
+	if recv == nil {
+		return ""
+	}
+	for _, rec := range recv.List {
+		receiver := receiverString(rec)
+		if receiver == "" {
+			return "has an unsupported receiver"
+		} else if reason, ok := ignored[receiver+"."+f.Name()]; ok {
+			return reason
+		}
+	}
+	recvType := f.Type().(*types.Signature).Recv().Type()
+	if ptr, ok := recvType.(*types.Pointer); ok {
+		recvType = ptr.Elem()
+	}
+	if obj := namedTypeName(recvType); obj != nil && f.Exported() && reflected[obj] != nil {
+		var sinks []string
+		for sink := range reflected[obj].Sinks {
+			if MethodReflectionSinks[sink] {
+				sinks = append(sinks, sink)
+			}
+		}
+		if len(sinks) > 0 {
+			sort.Strings(sinks)
+			return "receiver may be reached by " + sinks[0] + ", which looks up methods by name"
+		}
+	}
+	return ""
+}
+
+// methodName gets the qualified name of a method, which may
+// belong to the universe's error type.
+func (r *Renamer) methodName(f *types.Func) string {
+	if f.Pkg() == nil {
+		return "error." + f.Name()
+	}
+	return r.qualifiedName(f, false)
+}
+
+// groupImplementations groups the methods of every interface
+// with the methods that implement them, among the types of
+// the workspace and the standard library.
+//
+// Interfaces which are implemented by other interfaces are
+// grouped as well, since values of one may be converted to
+// the other.
+func groupImplementations(w *Workspace, groups *methodGroups) {
+	local := map[*types.Package]bool{}
+	for _, pkg := range w.Packages {
+		local[pkg.Types] = true
+	}
+
+	type candidate struct {
+		Type    types.Type
+		Methods *types.MethodSet
+		Local   bool
+	}
+	var candidates []*candidate
+	byName := map[string][]*candidate{}
+	seen := map[types.Type]bool{}
+	add := func(t types.Type, isLocal bool) {
+		t = types.Unalias(t)
+		if seen[t] {
+			return
+		}
+		seen[t] = true
+		if named, ok := t.(*types.Named); ok {
+			if named.TypeParams().Len() > named.TypeArgs().Len() {
+				// Uninstantiated generic types are only checked
+				// through their instances.
+				return
+			}
+		} else if !types.IsInterface(t) {
+			return
+		}
+		c := &candidate{Type: t, Local: isLocal}
+		if types.IsInterface(t) {
+			c.Methods = types.NewMethodSet(t)
+		} else {
+			c.Methods = types.NewMethodSet(types.NewPointer(t))
+		}
+		if c.Methods.Len() == 0 {
+			return
+		}
+		candidates = append(candidates, c)
+		for i := 0; i < c.Methods.Len(); i++ {
+			name := c.Methods.At(i).Obj().Name()
+			byName[name] = append(byName[name], c)
+		}
+	}
+
+	add(types.Universe.Lookup("error").Type(), false)
+	for _, pkg := range w.StdPackages() {
+		scope := pkg.Scope()
+		for _, name := range scope.Names() {
+			if obj, ok := scope.Lookup(name).(*types.TypeName); ok && !obj.IsAlias() {
+				add(obj.Type(), false)
+			}
+		}
+	}
+	for _, pkg := range w.SortedPackages() {
+		var exprs []ast.Expr
+		for expr := range pkg.Info.Types {
+			exprs = append(exprs, expr)
+		}
+		sort.Slice(exprs, func(i, j int) bool {
+			if exprs[i].Pos() != exprs[j].Pos() {
+				return exprs[i].Pos() < exprs[j].Pos()
+			}
+			return exprs[i].End() < exprs[j].End()
+		})
+		for _, expr := range exprs {
+			t := types.Unalias(pkg.Info.Types[expr].Type)
+			if ptr, ok := t.(*types.Pointer); ok {
+				t = types.Unalias(ptr.Elem())
+			}
+			switch t := t.(type) {
+			case *types.Named:
+				add(t, t.Obj().Pkg() != nil && local[t.Obj().Pkg()])
+			case *types.Interface:
+				add(t, true)
+			}
+		}
+		for _, ident := range sortedIdents(pkg.Info.Defs) {
+			if obj, ok := pkg.Info.Defs[ident].(*types.TypeName); ok && !obj.IsAlias() {
+				add(obj.Type(), true)
+			}
+		}
+	}
+
+	for _, iface := range candidates {
+		it, ok := iface.Type.Underlying().(*types.Interface)
+		if !ok || it.NumMethods() == 0 {
+			continue
+		}
+		for _, impl := range byName[it.Method(0).Name()] {
+			if impl == iface || (!impl.Local && !iface.Local) || !implements(impl.Type, it) {
+				continue
+			}
+			for i := 0; i < it.NumMethods(); i++ {
+				m := it.Method(i)
+				if sel := impl.Methods.Lookup(m.Pkg(), m.Name()); sel != nil {
+					if f, ok := sel.Obj().(*types.Func); ok {
+						groups.union(m, f)
+					}
+				}
+			}
+		}
+	}
+}
+
+// implements checks if a type, or a pointer to it,
+// implements an interface.
+func implements(t types.Type, iface *types.Interface) bool {
+	if types.IsInterface(t) {
+		return t.Underlying().(*types.Interface).IsMethodSet() && types.Implements(t, iface)
+	}
+	return types.Implements(t, iface) || types.Implements(types.NewPointer(t), iface)
+}
+
+// groupConstraints groups the methods of type parameter
+// constraints with the methods of the type arguments that
+// are passed for them.
+func groupConstraints(w *Workspace, groups *methodGroups) {
+	for _, pkg := range w.SortedPackages() {
+		for _, ident := range sortedIdents(pkg.Info.Instances) {
+			obj := pkg.Info.Uses[ident]
+			if obj == nil {
+				obj = pkg.Info.Defs[ident]
+			}
+			var params *types.TypeParamList
+			switch obj := obj.(type) {
+			case *types.Func:
+				params = obj.Origin().Type().(*types.Signature).TypeParams()
+			case *types.TypeName:
+				if named, ok := obj.Type().(*types.Named); ok {
+					params = named.Origin().TypeParams()
+				}
+			}
+			typeArgs := pkg.Info.Instances[ident].TypeArgs
+			for i := 0; i < params.Len() && i < typeArgs.Len(); i++ {
+				iface, ok := params.At(i).Constraint().Underlying().(*types.Interface)
+				if !ok {
+					continue
+				}
+				for j := 0; j < iface.NumMethods(); j++ {
+					m := iface.Method(j)
+					obj, _, _ := types.LookupFieldOrMethod(typeArgs.At(i), true, m.Pkg(), m.Name())
+					if f, ok := obj.(*types.Func); ok {
+						groups.union(m, f)
+					}
+				}
+			}
+		}
+	}
+}
+
+// sortedIdents sorts the keys of a map by their positions.
+func sortedIdents[V any](m map[*ast.Ident]V) []*ast.Ident {
+	var res []*ast.Ident
+	for ident := range m {
+		res = append(res, ident)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Pos() < res[j].Pos()
+	})
+	return res
+}
+
+// methodGroups is a union-find structure of methods which
+// must keep the same name as each other.
+//
+// Methods of instantiated types are represented by their
+// generic origins.
+type methodGroups struct {
+	parent map[*types.Func]*types.Func
+
+	// order lists the methods in the order they were added.
+	order []*types.Func
+}
+
+func (g *methodGroups) add(f *types.Func) *types.Func {
+	f = f.Origin()
+	if _, ok := g.parent[f]; !ok {
+		g.parent[f] = f
+		g.order = append(g.order, f)
+	}
+	return f
+}
+
+func (g *methodGroups) find(f *types.Func) *types.Func {
+	f = g.add(f)
+	for g.parent[f] != f {
+		g.parent[f] = g.parent[g.parent[f]]
+		f = g.parent[f]
+	}
+	return f
+}
+
+func (g *methodGroups) union(f1, f2 *types.Func) {
+	if root1, root2 := g.find(f1), g.find(f2); root1 != root2 {
+		g.parent[root2] = root1
+	}
+}
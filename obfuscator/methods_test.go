@@ -0,0 +1,73 @@
+package obfuscator
+
+import "testing"
+
+func TestMethodGroups(t *testing.T) {
+	dir := writeTestFiles(t, map[string]string{
+		"go.mod": "module example.com/app\n\ngo 1.22\n",
+		"shapes/shapes.go": `package shapes
+
+import "fmt"
+
+type Runner interface{ Run() string }
+
+type Base struct{}
+
+func (Base) Run() string { return "base" }
+
+// Wrapped implements Runner through its embedded field.
+type Wrapped struct{ Base }
+
+type Box[T any] struct{ v T }
+
+func NewBox[T any](v T) *Box[T] { return &Box[T]{v: v} }
+
+func (b *Box[T]) Run() string { return fmt.Sprint("box ", b.v) }
+
+type Named struct{}
+
+func (Named) String() string { return "named" }
+`,
+		"cmd/app/main.go": `package main
+
+import (
+	"fmt"
+
+	"example.com/app/shapes"
+)
+
+func main() {
+	for _, r := range []shapes.Runner{shapes.Wrapped{}, shapes.NewBox(3), shapes.NewBox("x")} {
+		fmt.Println(r.Run())
+	}
+	fmt.Println(shapes.Named{})
+}
+`,
+	})
+	res, output := runObfuscated(t, dir, "example.com/app/cmd/app", Options{})
+	if expected := "base\nbox 3\nbox x\nnamed\n"; output != expected {
+		t.Errorf("got output %q, expected %q", output, expected)
+	}
+
+	renames := testRenames(res)
+	var newName string
+	for _, name := range []string{
+		"example.com/app/shapes.Runner.Run",
+		"example.com/app/shapes.Base.Run",
+		"example.com/app/shapes.(*Box[...]).Run",
+	} {
+		obfuscated, ok := renames[name]
+		if !ok {
+			t.Errorf("%s was not renamed", name)
+			continue
+		}
+		if last := lastIdentifier(obfuscated); newName == "" {
+			newName = last
+		} else if last != newName {
+			t.Errorf("%s was renamed to %s, but other methods of its group to %s", name, last, newName)
+		}
+	}
+	if _, ok := renames["example.com/app/shapes.Named.String"]; ok {
+		t.Error("a method which implements fmt.Stringer was renamed")
+	}
+}
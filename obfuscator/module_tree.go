@@ -0,0 +1,221 @@
+package obfuscator
+
+import (
+	"bytes"
+	"fmt"
+	"go/version"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// vendoredModule is a module from an obfuscated GOPATH
+// which is copied into the vendor directory of a module
+// tree.
+type vendoredModule struct {
+	Path      string
+	GoVersion string
+	Packages  []string
+}
+
+// WriteModuleTree turns an obfuscated GOPATH into a
+// self-contained module which can be built with a plain
+// `go build` from outDir.
+//
+// The module of the main package becomes the root module,
+// and its packages keep their place in it. The main package
+// is moved to the root, unless the root of its module holds
+// another package. Every other module is vendored.
+// In GOPATH mode, every top-level directory of the GOPATH is
+// treated as a module.
+func WriteModuleTree(gopath, mainPkg, outDir string) error {
+	srcDir := filepath.Join(gopath, "src")
+	modules, err := workspaceModules(srcDir)
+	if err != nil {
+		return err
+	}
+	mainMod := packageModule(modules, mainPkg)
+	if mainMod == nil {
+		return fmt.Errorf("package %s is not part of any module", mainPkg)
+	}
+	mainDir := filepath.Join(srcDir, filepath.FromSlash(mainPkg))
+	modDir := filepath.Join(srcDir, filepath.FromSlash(mainMod.Path))
+	moveMain := mainDir == modDir || !containsGoFiles(modDir)
+
+	if err := os.Mkdir(outDir, 0755); err != nil {
+		return err
+	}
+	err = filepath.Walk(srcDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() || !containsGoFiles(path) {
+			return nil
+		}
+		pkgPath, err := filepath.Rel(srcDir, path)
+		if err != nil {
+			return err
+		}
+		pkgPath = filepath.ToSlash(pkgPath)
+		if pkgPath == mainPkg && moveMain {
+			return copyPackageFiles(path, outDir)
+		}
+		mod := packageModule(modules, pkgPath)
+		if mod == nil {
+			return fmt.Errorf("package %s is not part of any module", pkgPath)
+		}
+		if mod == mainMod {
+			rel := strings.TrimPrefix(strings.TrimPrefix(pkgPath, mod.Path), "/")
+			return copyPackageFiles(path, filepath.Join(outDir, filepath.FromSlash(rel)))
+		}
+		mod.Packages = append(mod.Packages, pkgPath)
+		return copyPackageFiles(path, filepath.Join(outDir, "vendor", filepath.FromSlash(pkgPath)))
+	})
+	if err != nil {
+		return err
+	}
+
+	var used []*vendoredModule
+	goVersion := "1.16"
+	for _, mod := range modules {
+		if mod != mainMod && len(mod.Packages) == 0 {
+			continue
+		}
+		if mod != mainMod {
+			if !strings.Contains(strings.Split(mod.Path, "/")[0], ".") {
+				return fmt.Errorf("module path %s has no dot in its first element", mod.Path)
+			}
+			used = append(used, mod)
+		}
+		if version.Compare("go"+mod.GoVersion, "go"+goVersion) > 0 {
+			goVersion = mod.GoVersion
+		}
+	}
+	sort.Slice(used, func(i, j int) bool {
+		return used[i].Path < used[j].Path
+	})
+
+	var goMod, modulesTxt bytes.Buffer
+	fmt.Fprintf(&goMod, "module %s\n\ngo %s\n", mainMod.Path, goVersion)
+	if len(used) > 0 {
+		goMod.WriteString("\nrequire (\n")
+	}
+	for _, mod := range used {
+		fmt.Fprintf(&goMod, "\t%s v0.0.0\n", mod.Path)
+		fmt.Fprintf(&modulesTxt, "# %s v0.0.0\n## explicit", mod.Path)
+		if mod.GoVersion != "" {
+			fmt.Fprintf(&modulesTxt, "; go %s", mod.GoVersion)
+		}
+		modulesTxt.WriteString("\n")
+		sort.Strings(mod.Packages)
+		for _, pkg := range mod.Packages {
+			fmt.Fprintln(&modulesTxt, pkg)
+		}
+	}
+	if len(used) > 0 {
+		goMod.WriteString(")\n")
+		txtPath := filepath.Join(outDir, "vendor", "modules.txt")
+		if err := ioutil.WriteFile(txtPath, modulesTxt.Bytes(), 0644); err != nil {
+			return err
+		}
+	}
+	return ioutil.WriteFile(filepath.Join(outDir, "go.mod"), goMod.Bytes(), 0644)
+}
+
+// workspaceModules finds the modules in a GOPATH source
+// directory.
+func workspaceModules(srcDir string) ([]*vendoredModule, error) {
+	var res []*vendoredModule
+	err := filepath.Walk(srcDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || info.Name() != "go.mod" {
+			return nil
+		}
+		modPath, err := filepath.Rel(srcDir, filepath.Dir(path))
+		if err != nil {
+			return err
+		}
+		goVersion, err := moduleGoVersion(path)
+		if err != nil {
+			return err
+		}
+		res = append(res, &vendoredModule{
+			Path:      filepath.ToSlash(modPath),
+			GoVersion: goVersion,
+		})
+		return nil
+	})
+	if err != nil || len(res) > 0 {
+		return res, err
+	}
+
+	listing, err := ioutil.ReadDir(srcDir)
+	if err != nil {
+		return nil, err
+	}
+	for _, item := range listing {
+		if item.IsDir() {
+			res = append(res, &vendoredModule{Path: item.Name()})
+		}
+	}
+	return res, nil
+}
+
+// packageModule finds the innermost module containing a
+// package.
+func packageModule(modules []*vendoredModule, pkgPath string) *vendoredModule {
+	var res *vendoredModule
+	for _, mod := range modules {
+		if pkgPath == mod.Path || strings.HasPrefix(pkgPath, mod.Path+"/") {
+			if res == nil || len(mod.Path) > len(res.Path) {
+				res = mod
+			}
+		}
+	}
+	return res
+}
+
+func containsGoFiles(dir string) bool {
+	listing, _ := ioutil.ReadDir(dir)
+	for _, item := range listing {
+		if !item.IsDir() && isGoFile(item.Name()) {
+			return true
+		}
+	}
+	return false
+}
+
+// copyPackageFiles copies the files of a package directory,
+// excluding sub-packages and go.mod files.
+func copyPackageFiles(srcDir, dstDir string) error {
+	if err := os.MkdirAll(dstDir, 0755); err != nil {
+		return err
+	}
+	return filepath.Walk(srcDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if path != srcDir && containsGoFiles(path) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if info.Name() == "go.mod" {
+			return nil
+		}
+		rel, err := filepath.Rel(srcDir, path)
+		if err != nil {
+			return err
+		}
+		dst := filepath.Join(dstDir, rel)
+		if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+			return err
+		}
+		return copyFile(path, dst)
+	})
+}
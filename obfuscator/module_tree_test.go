@@ -0,0 +1,34 @@
+package obfuscator
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWriteModuleTree(t *testing.T) {
+	dir := writeTestFiles(t, map[string]string{
+		"lib/go.mod": "module example.com/lib\n\ngo 1.22\n",
+		"lib/lib.go": "package lib\n\nfunc Greeting() string { return \"hello\" }\n",
+		"app/go.mod": "module example.com/app\n\ngo 1.22\n\nrequire example.com/lib v0.0.0\n\n" +
+			"replace example.com/lib => ../lib\n",
+		"app/util/util.go": "package util\n\nimport \"example.com/lib\"\n\n" +
+			"func Message(name string) string { return lib.Greeting() + \", \" + name }\n",
+		"app/cmd/hello/main.go": "package main\n\nimport (\n\t\"fmt\"\n\n\t\"example.com/app/util\"\n)\n\n" +
+			"func main() { fmt.Println(util.Message(\"world\")) }\n",
+	})
+	appDir := filepath.Join(dir, "app")
+	_, output := runObfuscated(t, appDir, "example.com/app/cmd/hello", Options{})
+	if output != "hello, world\n" {
+		t.Errorf("unexpected output: %q", output)
+	}
+
+	goMod, err := ioutil.ReadFile(filepath.Join(appDir, "obfuscated", "go.mod"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(goMod), "example.com") {
+		t.Errorf("go.mod leaks a module path:\n%s", goMod)
+	}
+}
@@ -0,0 +1,254 @@
+package obfuscator
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go/build"
+	"go/version"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// A listedPackage is a package as reported by `go list -json`.
+type listedPackage struct {
+	build.Package
+
+	Standard   bool
+	ForTest    string
+	EmbedFiles []string
+	Module     *listedModule
+	Error      *listedError
+}
+
+type listedModule struct {
+	Path      string
+	Version   string
+	Main      bool
+	Dir       string
+	GoVersion string
+}
+
+type listedError struct {
+	Err string
+}
+
+// moduleMode checks if the go command resolves packages
+// using modules from the current directory.
+func moduleMode() bool {
+	out, err := exec.Command("go", "env", "GOMOD").Output()
+	if err != nil {
+		return false
+	}
+	gomod := strings.TrimSpace(string(out))
+	return gomod != "" && gomod != os.DevNull
+}
+
+// listModuleDeps lists packages and all of their
+// dependencies for a build configuration using the go
+// command, which takes care of go.mod, vendor directories,
+// replace directives and the local module cache.
+func listModuleDeps(packageNames []string, tests bool, config BuildConfig) ([]*listedPackage, error) {
+	env, flags := config.goArgs()
+	args := append([]string{"list", "-deps", "-json"}, flags...)
+	if tests {
+		args = append(args, "-test")
+	}
+	args = append(args, packageNames...)
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("go", args...)
+	cmd.Env = append(os.Environ(), env...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("go list: %s", strings.TrimSpace(stderr.String()))
+	}
+
+	var res []*listedPackage
+	decoder := json.NewDecoder(&stdout)
+	for {
+		var pkg listedPackage
+		if err := decoder.Decode(&pkg); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		if pkg.Error != nil {
+			return nil, fmt.Errorf("package %s: %s", pkg.ImportPath, pkg.Error.Err)
+		}
+		if pkg.ForTest != "" || strings.HasSuffix(pkg.ImportPath, ".test") {
+			// Test variants are covered by the packages they test.
+			continue
+		}
+		res = append(res, &pkg)
+	}
+	return res, nil
+}
+
+// copyModuleDeps copies packages and their dependencies out
+// of the current module into a GOPATH layout, keeping their
+// original import paths.
+// A minimal go.mod is written at the root of every module
+// that contributed a package, so that the workspace can be
+// built as a set of modules later.
+func copyModuleDeps(packageNames []string, newGopath string, keepTests bool, configs []BuildConfig) error {
+	var pkgs []*listedPackage
+	for _, config := range configs {
+		listed, err := listModuleDeps(packageNames, keepTests, config)
+		if err != nil {
+			return err
+		}
+		pkgs = append(pkgs, listed...)
+	}
+	modules := map[string]*listedModule{}
+	for _, pkg := range pkgs {
+		if pkg.Standard || pkg.ImportPath == "C" {
+			continue
+		}
+		if err := copyDep(&pkg.Package, newGopath, keepTests); err != nil {
+			return err
+		}
+		if err := copyEmbedFiles(pkg, newGopath); err != nil {
+			return err
+		}
+		if pkg.Module != nil {
+			modules[pkg.Module.Path] = pkg.Module
+		}
+	}
+	for _, mod := range modules {
+		if err := writeModuleFile(newGopath, mod); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func copyEmbedFiles(pkg *listedPackage, newGopath string) error {
+	for _, file := range pkg.EmbedFiles {
+		dst := filepath.Join(newGopath, "src", pkg.ImportPath, file)
+		if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+			return err
+		}
+		if err := copyFile(filepath.Join(pkg.Dir, file), dst); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeModuleFile(newGopath string, mod *listedModule) error {
+	dir := filepath.Join(newGopath, "src", mod.Path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(dir, "go.mod"), moduleFileData(mod.Path, mod.GoVersion), 0644)
+}
+
+func moduleFileData(modPath, goVersion string) []byte {
+	var data bytes.Buffer
+	fmt.Fprintf(&data, "module %s\n", modPath)
+	if goVersion != "" {
+		fmt.Fprintf(&data, "\ngo %s\n", goVersion)
+	}
+	return data.Bytes()
+}
+
+// WriteGoWork prepares a GOPATH created by CopyGopath to be
+// built as a Go workspace.
+//
+// Every go.mod in the GOPATH gets its module path updated
+// to match its (possibly obfuscated) location, and a go.work
+// file is created which uses all of these modules.
+//
+// The path to the go.work file is returned, or "" if the
+// GOPATH does not contain any modules.
+func WriteGoWork(gopath string) (string, error) {
+	srcDir := filepath.Join(gopath, "src")
+	var modDirs []string
+	goVersion := "1.16"
+	err := filepath.Walk(srcDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || info.Name() != "go.mod" {
+			return nil
+		}
+		dir := filepath.Dir(path)
+		modPath, err := filepath.Rel(srcDir, dir)
+		if err != nil {
+			return err
+		}
+		modVersion, err := moduleGoVersion(path)
+		if err != nil {
+			return err
+		}
+		if version.Compare("go"+modVersion, "go"+goVersion) > 0 {
+			goVersion = modVersion
+		}
+		data := moduleFileData(filepath.ToSlash(modPath), modVersion)
+		if err := ioutil.WriteFile(path, data, 0644); err != nil {
+			return err
+		}
+		modDirs = append(modDirs, dir)
+		return nil
+	})
+	if err != nil || len(modDirs) == 0 {
+		return "", err
+	}
+	sort.Strings(modDirs)
+
+	var data bytes.Buffer
+	fmt.Fprintf(&data, "go %s\n\n", goVersion)
+	for _, dir := range modDirs {
+		// Relative paths keep the workspace the same wherever
+		// the GOPATH is.
+		rel, err := filepath.Rel(gopath, dir)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(&data, "use ./%s\n", filepath.ToSlash(rel))
+	}
+	workPath := filepath.Join(gopath, "go.work")
+	if err := ioutil.WriteFile(workPath, data.Bytes(), 0644); err != nil {
+		return "", err
+	}
+	return workPath, nil
+}
+
+func moduleGoVersion(path string) (string, error) {
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	for _, line := range strings.Split(string(contents), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 2 && fields[0] == "go" {
+			if !version.IsValid("go" + fields[1]) {
+				return "", errors.New("invalid go version in " + path + ": " + fields[1])
+			}
+			return fields[1], nil
+		}
+	}
+	return "", nil
+}
+
+// gopathContext creates a build context for a config which
+// resolves packages strictly from the given GOPATH.
+func gopathContext(gopath string, config BuildConfig) build.Context {
+	ctx := config.context()
+	ctx.GOPATH = gopath
+
+	// A custom JoinPath prevents go/build from delegating to
+	// `go list`, which would resolve packages against the
+	// module in the working directory instead of the GOPATH.
+	ctx.JoinPath = filepath.Join
+
+	return ctx
+}
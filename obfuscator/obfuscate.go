@@ -0,0 +1,396 @@
+// Package obfuscator obfuscates Go packages along with all
+// of their dependencies, and compiles binaries from the
+// obfuscated source code.
+//
+// Obfuscate runs the whole pipeline, but every stage of it
+// (CopyGopath, ObfuscatePackageNames, ObfuscateSymbols,
+// ObfuscateStrings, WriteGoWork, WriteModuleTree and Build)
+// can also be run on its own.
+package obfuscator
+
+import (
+	"context"
+	crand "crypto/rand"
+	"errors"
+	"fmt"
+	"go/build"
+	"io/ioutil"
+	"log"
+	"math/rand"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// An OutputMode determines what Obfuscate produces.
+type OutputMode int
+
+const (
+	// OutputBinary compiles every target into a binary.
+	OutputBinary OutputMode = iota
+
+	// OutputGopath leaves the obfuscated GOPATH at the
+	// output path of the only target.
+	OutputGopath
+
+	// OutputModule writes a self-contained module for every
+	// target, as done by WriteModuleTree.
+	OutputModule
+)
+
+// A Target is a main package to obfuscate, along with the
+// path where its output is written.
+type Target struct {
+	Package string
+	Output  string
+}
+
+// BuildOptions configures the compilation of obfuscated
+// packages.
+type BuildOptions struct {
+	// Tags is passed to the go compiler.
+	Tags string
+
+	// WinHide hides the console window of Windows GUIs.
+	WinHide bool
+
+	// NoStaticLink disables static linking.
+	NoStaticLink bool
+
+	// Verbose prints the build command and environment.
+	Verbose bool
+}
+
+// Options configures Obfuscate.
+type Options struct {
+	Targets []Target
+	Mode    OutputMode
+
+	// Padding is used for hashing sensitive information.
+	// If it is empty, a random padding is used.
+	Padding NameHasher
+
+	// KeepTests keeps _test.go files.
+	KeepTests bool
+
+	// PreservePackageName keeps the paths of the targets,
+	// so that they are built from their original package
+	// paths.
+	PreservePackageName bool
+
+	// InjectTags enables Renamer.InjectTags.
+	InjectTags bool
+
+	// Strings is the cipher used for string literals.
+	Strings StringCipher
+
+	// Rand, if non-nil, makes every random choice, including
+	// the padding if it is empty, so that the same inputs
+	// always produce the same outputs.
+	Rand *rand.Rand
+
+	// Configs are additional build configurations, such as
+	// other platforms, which the obfuscated code must still
+	// build for. Renames are kept consistent across all of
+	// them and the configuration of the build itself (the
+	// default platform with BuildOptions.Tags).
+	// Tags is added to the tags of every configuration.
+	Configs []BuildConfig
+
+	// ImportMapping, if non-nil, provides the names of
+	// packages and symbols from a previous build.
+	// See Renamer.Import.
+	ImportMapping *Mapping
+
+	// DryRun stops after analyzing the copied GOPATH, so
+	// that nothing is renamed, encrypted or written to the
+	// outputs. The result describes what would have been
+	// done.
+	DryRun bool
+
+	// Policy, if non-nil, decides which packages, names and
+	// strings are obfuscated.
+	// Its tags, platforms and output settings are used for
+	// any of the corresponding options which are not set.
+	Policy *Policy
+
+	BuildOptions
+}
+
+// A Result describes a successful call to Obfuscate.
+type Result struct {
+	// Padding is the padding that was used for hashing.
+	Padding NameHasher
+
+	// Mapping records every package move and symbol rename.
+	Mapping *Mapping
+
+	// Skipped lists the names which were deliberately not
+	// renamed.
+	Skipped []*Skip
+
+	// Linknames lists the //go:linkname directives which
+	// were rewritten to use new names.
+	Linknames []*Linkname
+
+	// Strings and Consts list the string literals and the
+	// uses of string constants which would be encrypted.
+	// They are only set by a dry run.
+	Strings []*PlannedString
+	Consts  []*PlannedConst
+
+	// SkippedStrings lists the string literals which would
+	// be left alone, with the reasons. It is only set by a
+	// dry run.
+	SkippedStrings []*PlannedString
+
+	// Packages maps the package of every target to the
+	// package that its output was produced from.
+	Packages map[string]string
+}
+
+// Obfuscate copies the targets and their dependencies into
+// a new GOPATH, obfuscates it, and produces the output for
+// every target according to the mode.
+func Obfuscate(ctx context.Context, opts Options) (*Result, error) {
+	if len(opts.Targets) == 0 {
+		return nil, errors.New("no targets")
+	}
+	if err := opts.applyPolicy(); err != nil {
+		return nil, fmt.Errorf("apply policy: %s", err)
+	}
+	if opts.Mode == OutputGopath && len(opts.Targets) > 1 {
+		return nil, errors.New("a GOPATH can only be output for a single target")
+	}
+
+	var newGopath string
+	if opts.Mode == OutputGopath && !opts.DryRun {
+		newGopath = opts.Targets[0].Output
+		if err := os.Mkdir(newGopath, 0755); err != nil {
+			return nil, fmt.Errorf("create destination: %s", err)
+		}
+	} else {
+		var err error
+		newGopath, err = ioutil.TempDir("", "")
+		if err != nil {
+			return nil, fmt.Errorf("create temp dir: %s", err)
+		}
+		defer os.RemoveAll(newGopath)
+	}
+
+	n := opts.Padding
+	if len(n) == 0 {
+		n = make(NameHasher, 32)
+		if opts.Rand != nil {
+			opts.Rand.Read(n)
+		} else {
+			crand.Read(n)
+		}
+	}
+	res := &Result{Padding: n, Packages: map[string]string{}}
+
+	// Tags apply to every configuration, once the policy has
+	// been merged into them.
+	tags := SplitTags(opts.Tags)
+	configs := []BuildConfig{HostConfig(tags)}
+	for _, config := range opts.Configs {
+		config.Tags = append(append([]string{}, config.Tags...), tags...)
+		if config.String() != configs[0].String() {
+			configs = append(configs, config)
+		}
+	}
+
+	log.Println("Copying GOPATH...")
+	var pkgNames []string
+	for _, target := range opts.Targets {
+		pkgNames = append(pkgNames, target.Package)
+	}
+	if err := CopyGopath(pkgNames, newGopath, opts.KeepTests, configs...); err != nil {
+		return nil, fmt.Errorf("copy into a new GOPATH: %s", err)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	log.Println("Loading packages...")
+	renamer, err := NewRenamer(newGopath, n, configs...)
+	if err != nil {
+		return nil, fmt.Errorf("load packages: %s", err)
+	}
+	renamer.InjectTags = opts.InjectTags
+	renamer.Policy = opts.Policy
+	if opts.PreservePackageName {
+		for _, target := range opts.Targets {
+			renamer.KeepPaths[target.Package] = true
+		}
+	}
+	if opts.ImportMapping != nil {
+		renamer.Import(opts.ImportMapping)
+	}
+	log.Println("Obfuscating package names and symbols...")
+	if err := renamer.RenamePackages(); err != nil {
+		return nil, fmt.Errorf("obfuscate package names: %s", err)
+	}
+	if err := renamer.RenameSymbols(); err != nil {
+		return nil, fmt.Errorf("obfuscate symbols: %s", err)
+	}
+	res.Mapping = renamer.Mapping()
+	res.Skipped = renamer.Skipped
+	res.Linknames = renamer.Linknames
+	if opts.DryRun {
+		for _, target := range opts.Targets {
+			res.Packages[target.Package] = target.Package
+			if movedPkg, ok := renamer.Packages[target.Package]; ok {
+				res.Packages[target.Package] = movedPkg
+			}
+		}
+		planOpts := &StringOptions{Policy: opts.Policy, Configs: configs}
+		plan, err := PlanStrings(newGopath, planOpts)
+		if err != nil {
+			return nil, fmt.Errorf("plan strings: %s", err)
+		}
+		res.Strings, res.Consts, res.SkippedStrings = plan.Strings, plan.Consts, plan.Skipped
+		return res, nil
+	}
+	if err := renamer.Apply(); err != nil {
+		return nil, fmt.Errorf("apply renames: %s", err)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	// Strings are obfuscated after renaming, so that the
+	// positions in the mapping match the original source.
+	log.Println("Obfuscating strings...")
+	stringOpts := &StringOptions{
+		Cipher:  opts.Strings,
+		Padding: n,
+		Policy:  opts.Policy.Moved(renamer.Packages),
+		Configs: configs,
+		Rand:    opts.Rand,
+	}
+	if err := ObfuscateStrings(newGopath, stringOpts); err != nil {
+		return nil, fmt.Errorf("obfuscate strings: %s", err)
+	}
+
+	if _, err := WriteGoWork(newGopath); err != nil {
+		return nil, fmt.Errorf("create go.work: %s", err)
+	}
+
+	for _, target := range opts.Targets {
+		newPkg := target.Package
+		if movedPkg, ok := renamer.Packages[newPkg]; ok {
+			newPkg = movedPkg
+		}
+		res.Packages[target.Package] = newPkg
+
+		switch opts.Mode {
+		case OutputModule:
+			if err := WriteModuleTree(newGopath, newPkg, target.Output); err != nil {
+				return nil, fmt.Errorf("create module tree: %s", err)
+			}
+		case OutputBinary:
+			if err := Build(ctx, newGopath, newPkg, target.Output, &opts.BuildOptions); err != nil {
+				return nil, fmt.Errorf("compile %s: %s", target.Package, err)
+			}
+		}
+	}
+	return res, nil
+}
+
+// applyPolicy fills in the options which are not set from
+// the tags, platforms and output settings of the policy.
+func (opts *Options) applyPolicy() error {
+	p := opts.Policy
+	if p == nil {
+		return nil
+	}
+	if err := p.compile(); err != nil {
+		return err
+	}
+	if opts.Mode == OutputBinary {
+		mode, err := p.OutputMode()
+		if err != nil {
+			return err
+		}
+		opts.Mode = mode
+	}
+	if opts.Tags == "" {
+		opts.Tags = p.Tags
+	}
+	if len(opts.Configs) == 0 && p.Platforms != "" {
+		configs, err := ParseBuildConfigs(p.Platforms)
+		if err != nil {
+			return err
+		}
+		opts.Configs = configs
+	}
+	opts.KeepTests = opts.KeepTests || p.Output.KeepTests
+	opts.WinHide = opts.WinHide || p.Output.WinHide
+	opts.NoStaticLink = opts.NoStaticLink || p.Output.NoStaticLink
+	return nil
+}
+
+// Build compiles a package from an obfuscated GOPATH.
+//
+// If the GOPATH contains a go.work file, as created by
+// WriteGoWork, it is built as a workspace of modules.
+func Build(ctx context.Context, gopath, pkgName, outPath string, opts *BuildOptions) error {
+	buildCtx := build.Default
+
+	ldflags := `-s -w`
+	if opts.WinHide {
+		ldflags += " -H=windowsgui"
+	}
+	if !opts.NoStaticLink {
+		ldflags += ` -extldflags '-static'`
+	}
+
+	goCache := gopath + "/cache"
+	os.Mkdir(goCache, 0755)
+
+	absOutPath, err := filepath.Abs(outPath)
+	if err != nil {
+		return err
+	}
+
+	arguments := []string{"build", "-trimpath", "-ldflags", ldflags, "-tags", opts.Tags, "-o", absOutPath, pkgName}
+	environment := []string{
+		"GOROOT=" + buildCtx.GOROOT,
+		"GOARCH=" + buildCtx.GOARCH,
+		"GOOS=" + buildCtx.GOOS,
+		"GOPATH=" + gopath,
+		"PATH=" + os.Getenv("PATH"),
+		"GOCACHE=" + goCache,
+	}
+	workFile := filepath.Join(gopath, "go.work")
+	if _, err := os.Stat(workFile); err == nil {
+		// Every dependency lives in the workspace, so the
+		// build never needs the network or the module cache.
+		environment = append(environment, "GO111MODULE=on", "GOWORK="+workFile,
+			"GOFLAGS=-mod=readonly", "GOPROXY=off")
+	} else {
+		// needs to be off to make Go search GOPATH
+		environment = append(environment, "GO111MODULE=off")
+	}
+
+	cmd := exec.CommandContext(ctx, "go", arguments...)
+	cmd.Env = environment
+	cmd.Dir = gopath
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	if opts.Verbose {
+		fmt.Println()
+		fmt.Println("[Verbose] Temporary path:", gopath)
+		fmt.Println("[Verbose] Go build command: go", strings.Join(arguments, " "))
+		fmt.Println("[Verbose] Environment variables:")
+		for _, envLine := range environment {
+			fmt.Println(envLine)
+		}
+		fmt.Println()
+	}
+
+	return cmd.Run()
+}
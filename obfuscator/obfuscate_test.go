@@ -0,0 +1,96 @@
+package obfuscator
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+// writeTestFiles writes files, keyed by slash-separated
+// paths, into a temporary directory which is removed when
+// the test ends.
+func writeTestFiles(t *testing.T, files map[string]string) string {
+	if testing.Short() {
+		t.Skip("skipping obfuscation in short mode")
+	}
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go command not found")
+	}
+	dir, err := ioutil.TempDir("", "gobfuscate_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	for name, contents := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+// obfuscateTest runs Obfuscate from the module in dir.
+// The padding is fixed unless opts sets one.
+func obfuscateTest(t *testing.T, dir string, opts Options) *Result {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+	t.Setenv("GOFLAGS", "")
+	t.Setenv("GOWORK", "off")
+	t.Setenv("GO111MODULE", "on")
+
+	if opts.Padding == nil {
+		opts.Padding = NameHasher("test")
+	}
+	res, err := Obfuscate(context.Background(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return res
+}
+
+// testRenames maps the original names of a result's
+// mapping to their new names.
+func testRenames(res *Result) map[string]string {
+	renames := map[string]string{}
+	for _, entry := range res.Mapping.Entries {
+		renames[entry.Original] = entry.Obfuscated
+	}
+	return renames
+}
+
+// runObfuscated obfuscates a main package from the module
+// in dir into a module tree, then builds and runs it.
+// The tree is built with the usual build cache, which is
+// much faster than Build with its fresh cache.
+func runObfuscated(t *testing.T, dir, pkg string, opts Options) (*Result, string) {
+	outDir := filepath.Join(dir, "obfuscated")
+	opts.Targets = []Target{{Package: pkg, Output: outDir}}
+	opts.Mode = OutputModule
+	res := obfuscateTest(t, dir, opts)
+
+	binPath := filepath.Join(dir, "obfuscated_binary")
+	build := exec.Command("go", "build", "-o", binPath, ".")
+	build.Dir = outDir
+	build.Env = append(build.Environ(), "GOFLAGS=", "GOWORK=off", "GO111MODULE=on")
+	if output, err := build.CombinedOutput(); err != nil {
+		t.Fatalf("go build: %s\n%s", err, output)
+	}
+	output, err := exec.Command(binPath).CombinedOutput()
+	if err != nil {
+		t.Fatalf("run %s: %s\n%s", pkg, err, output)
+	}
+	return res, string(output)
+}
@@ -0,0 +1,168 @@
+package obfuscator
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ObfuscatePackageNames moves every package in a GOPATH
+// which the policy renames (or every package if policy is
+// nil) to a hashed path.
+func ObfuscatePackageNames(gopath string, n NameHasher, policy *Policy) error {
+	r, err := NewRenamer(gopath, n)
+	if err != nil {
+		return err
+	}
+	r.Policy = policy
+	if err := r.RenamePackages(); err != nil {
+		return fmt.Errorf("package renames: %s", err)
+	}
+	return r.Apply()
+}
+
+// RenamePackages adds a move for every package in the
+// workspace, hashing each component of its import path.
+//
+// Components are salted with the path of the module that
+// contains the package, or with the package path itself
+// outside of modules, so that common prefixes such as
+// "github.com" are hashed differently for every module.
+//
+// The first component of a path ends with a dot suffix, as
+// module paths require, unless assembly refers to a package
+// of its module by path, since assembly cannot spell a dot
+// in a path.
+//
+// Packages in r.KeepPaths, excluded by r.Policy or marked
+// with //gobfuscate:ignore, along with their parent
+// directories, keep their paths.
+// Paths from an imported mapping take precedence.
+func (r *Renamer) RenamePackages() error {
+	srcDir := filepath.Join(r.Workspace.Gopath, "src")
+	roots, err := moduleRoots(srcDir)
+	if err != nil {
+		return err
+	}
+	if err := r.Policy.compile(); err != nil {
+		return err
+	}
+	kept := map[string]bool{}
+	for path := range r.KeepPaths {
+		kept[path] = true
+	}
+	for _, w := range r.workspaces() {
+		for path := range w.Packages {
+			if !r.Policy.renames(path) || r.ignoresPackage(path) {
+				kept[path] = true
+			}
+		}
+	}
+	keep := func(dir string) bool {
+		for path := range kept {
+			if path == dir || strings.HasPrefix(path, dir+"/") {
+				return true
+			}
+		}
+		return false
+	}
+	rootOf := func(path string) string {
+		for _, modPath := range roots {
+			if path == modPath || strings.HasPrefix(path, modPath+"/") {
+				return modPath
+			}
+		}
+		return path
+	}
+	asmRoots := map[string]bool{}
+	for _, w := range r.workspaces() {
+		for _, pkg := range w.Packages {
+			refs, err := asmPackageRefs(pkg.Build.Dir)
+			if err != nil {
+				return err
+			}
+			for _, path := range refs {
+				asmRoots[rootOf(path)] = true
+			}
+		}
+	}
+	move := func(path string) string {
+		root := rootOf(path)
+		newPath := encryptComponents(path, root, r.Hasher, keep, !asmRoots[root])
+		newPath = r.importedPath(path, newPath)
+		if newPath != path {
+			oldDir := filepath.Join(srcDir, filepath.FromSlash(path))
+			r.Dirs[oldDir] = filepath.Join(srcDir, filepath.FromSlash(newPath))
+		}
+		return newPath
+	}
+
+	for _, w := range r.workspaces() {
+		for path, pkg := range w.Packages {
+			if pkg.XTest {
+				continue
+			}
+			if newPath := move(path); newPath != path {
+				r.Packages[path] = newPath
+			}
+		}
+	}
+	for _, modPath := range roots {
+		move(modPath)
+	}
+	return nil
+}
+
+// hashedDomainSuffix is added to a hashed first component
+// of an import path, since module paths need a dot in
+// their first element.
+const hashedDomainSuffix = ".invalid"
+
+// encryptComponents hashes every component of an import
+// path in the domain of root, except for the components
+// of directories for which keep returns true.
+// If dotted is set, a hashed first component ends with
+// hashedDomainSuffix.
+func encryptComponents(pkgPath, root string, n NameHasher, keep func(dir string) bool,
+	dotted bool) string {
+	comps := strings.Split(pkgPath, "/")
+	res := make([]string, len(comps))
+	for i, comp := range comps {
+		if keep != nil && keep(strings.Join(comps[:i+1], "/")) {
+			res[i] = comp
+		} else if i == 0 && dotted {
+			res[i] = strings.ToLower(n.Hash(root, KindPackage, comp)) + hashedDomainSuffix
+		} else {
+			res[i] = n.Hash(root, KindPackage, comp)
+		}
+	}
+	return strings.Join(res, "/")
+}
+
+// moduleRoots finds the module paths in a GOPATH source
+// directory, from the innermost to the outermost.
+func moduleRoots(srcDir string) ([]string, error) {
+	var res []string
+	err := filepath.Walk(srcDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || info.Name() != "go.mod" {
+			return nil
+		}
+		modPath, err := filepath.Rel(srcDir, filepath.Dir(path))
+		if err != nil {
+			return err
+		}
+		res = append(res, filepath.ToSlash(modPath))
+		return nil
+	})
+	// Longer paths must come first so that packages are
+	// matched with their innermost module.
+	sort.Slice(res, func(i, j int) bool {
+		return len(res[i]) > len(res[j])
+	})
+	return res, err
+}
@@ -0,0 +1,182 @@
+package obfuscator
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"sort"
+	"strconv"
+)
+
+// A PlannedString is a string literal which would be
+// encrypted, or which would be left alone for a reason.
+type PlannedString struct {
+	Position string `json:"position"`
+	Value    string `json:"value"`
+	Reason   string `json:"reason,omitempty"`
+}
+
+// A PlannedConst is a use of string constants which would
+// be replaced with an encrypted value.
+type PlannedConst struct {
+	Position string   `json:"position"`
+	Names    []string `json:"names"`
+	Value    string   `json:"value"`
+}
+
+// A StringPlan lists what ObfuscateStrings would do.
+type StringPlan struct {
+	Strings []*PlannedString
+	Consts  []*PlannedConst
+
+	// Skipped are the string literals which would be left
+	// alone, such as those in constant declarations, or in
+	// code excluded by the policy or by directives.
+	Skipped []*PlannedString
+}
+
+// PlanStrings finds the strings and uses of constants that
+// ObfuscateStrings would encrypt, and the strings that it
+// would skip, without changing anything.
+// The cipher, padding and random generator of the options
+// are not used.
+func PlanStrings(gopath string, opts *StringOptions) (*StringPlan, error) {
+	if opts == nil {
+		opts = &StringOptions{}
+	}
+	var paths []string
+	skipReasons := map[string]string{}
+	err := walkStringFiles(gopath, opts.Policy, func(path, skipReason string) error {
+		paths = append(paths, path)
+		if skipReason != "" {
+			skipReasons[path] = skipReason
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	var uses map[string][]*constUse
+	if len(skipReasons) < len(paths) {
+		uses, err = findConstUses(gopath, opts.Configs)
+		if err != nil {
+			return nil, fmt.Errorf("type-check constants: %s", err)
+		}
+	}
+
+	res := &StringPlan{}
+	for _, path := range paths {
+		err := planFileStrings(gopath, path, skipReasons[path], opts.Policy, uses[path], res)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+// planFileStrings adds the strings of a file to a plan.
+// If skipReason is set, every string of the file is
+// skipped for that reason.
+func planFileStrings(gopath, path, skipReason string, policy *Policy, uses []*constUse,
+	plan *StringPlan) error {
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	set := token.NewFileSet()
+	file, err := parser.ParseFile(set, path, contents, parser.ParseComments)
+	if err != nil {
+		return nil
+	}
+	tokFile := set.File(file.Pos())
+	if skipReason == "" && fileHasDirective(file, noStringsDirective) {
+		skipReason = "its file is marked with " + noStringsDirective
+	}
+
+	// Strings are listed in order, whether they are literals
+	// or literal expressions of named types.
+	strsByOffset := map[int]*PlannedString{}
+	skippedByOffset := map[int]*PlannedString{}
+	addLiteral := func(m map[int]*PlannedString, node *ast.BasicLit, reason string) error {
+		value, err := strconv.Unquote(node.Value)
+		if err != nil {
+			return err
+		}
+		m[tokFile.Offset(node.Pos())] = &PlannedString{
+			Position: srcPosition(gopath, set.Position(node.Pos())),
+			Value:    value,
+			Reason:   reason,
+		}
+		return nil
+	}
+	if skipReason != "" {
+		for _, node := range stringLiterals(file) {
+			if err := addLiteral(skippedByOffset, node, skipReason); err != nil {
+				return err
+			}
+		}
+		plan.Skipped = append(plan.Skipped, sortedStrings(skippedByOffset)...)
+		return nil
+	}
+
+	for _, use := range uses {
+		if use.Keep || policy.excludesString(use.Value) {
+			continue
+		}
+		position := srcPosition(gopath, set.Position(tokFile.Pos(use.Start)))
+		if len(use.Names) == 0 {
+			strsByOffset[use.Start] = &PlannedString{Position: position, Value: use.Value}
+		} else {
+			plan.Consts = append(plan.Consts, &PlannedConst{Position: position, Names: use.Names,
+				Value: use.Value})
+		}
+	}
+
+	obfuscator := &stringObfuscator{Contents: contents, Policy: policy, Uses: uses}
+	for _, decl := range file.Decls {
+		ast.Walk(obfuscator, decl)
+	}
+	nodes, _, err := obfuscator.Literals()
+	if err != nil {
+		return err
+	}
+	for _, node := range nodes {
+		if err := addLiteral(strsByOffset, node, ""); err != nil {
+			return err
+		}
+	}
+	for node, reason := range obfuscator.Skipped {
+		if err := addLiteral(skippedByOffset, node, reason); err != nil {
+			return err
+		}
+	}
+	for _, node := range obfuscator.Nodes {
+		value, err := strconv.Unquote(node.Value)
+		if err != nil {
+			return err
+		}
+		if reason := obfuscator.skipReason(node, value); reason != "" {
+			if err := addLiteral(skippedByOffset, node, reason); err != nil {
+				return err
+			}
+		}
+	}
+	plan.Strings = append(plan.Strings, sortedStrings(strsByOffset)...)
+	plan.Skipped = append(plan.Skipped, sortedStrings(skippedByOffset)...)
+	return nil
+}
+
+func sortedStrings(byOffset map[int]*PlannedString) []*PlannedString {
+	var offsets []int
+	for offset := range byOffset {
+		offsets = append(offsets, offset)
+	}
+	sort.Ints(offsets)
+	var res []*PlannedString
+	for _, offset := range offsets {
+		res = append(res, byOffset[offset])
+	}
+	return res
+}
@@ -0,0 +1,86 @@
+package obfuscator
+
+import "testing"
+
+func TestPlanSkippedStrings(t *testing.T) {
+	dir := writeTestFiles(t, map[string]string{
+		"go.mod": "module example.com/app\n\ngo 1.22\n",
+		"util/util.go": `package util
+
+const Greeting = "const text"
+
+type Record struct {
+	Name string ` + "`json:\"tag text\"`" + `
+}
+
+func Encrypted() string { return "encrypted text" }
+
+func Excluded() string { return "excluded text" }
+
+//gobfuscate:nostrings
+func Plain() string { return "function text" }
+
+var sizes [len("array text")]int
+`,
+		"util/file.go": `//gobfuscate:nostrings
+
+package util
+
+func File() string { return "file text" }
+`,
+		"ignored/ignored.go": `//gobfuscate:ignore
+
+package ignored
+
+func Hello() string { return "ignored text" }
+`,
+		"cmd/app/main.go": `package main
+
+import (
+	"example.com/app/ignored"
+	"example.com/app/util"
+)
+
+func main() {
+	println(util.Greeting, util.Encrypted(), util.Excluded(), util.Plain(), util.File(), ignored.Hello())
+}
+`,
+	})
+	res := obfuscateTest(t, dir, Options{
+		Targets: []Target{{Package: "example.com/app/cmd/app"}},
+		DryRun:  true,
+		Policy:  &Policy{ExcludeStrings: []string{"^excluded"}},
+	})
+
+	expected := map[string]string{
+		"const text":      "constant declarations cannot be encrypted",
+		`json:"tag text"`: "struct tags are kept",
+		"excluded text":   "excluded by the policy",
+		"function text":   "its function is marked with " + noStringsDirective,
+		"array text":      "must stay constant",
+		"file text":       "its file is marked with " + noStringsDirective,
+		"ignored text":    "its package is marked with " + ignoreDirective,
+	}
+	actual := map[string]*PlannedString{}
+	for _, s := range res.SkippedStrings {
+		actual[s.Value] = s
+	}
+	for value, reason := range expected {
+		s, ok := actual[value]
+		if !ok {
+			t.Errorf("%q is not listed as skipped", value)
+		} else if s.Reason != reason || s.Position == "" {
+			t.Errorf("%q is skipped at %q because %q, expected %q", value, s.Position, s.Reason, reason)
+		}
+	}
+	if _, ok := actual["encrypted text"]; ok {
+		t.Error("an encrypted string is listed as skipped")
+	}
+	var encrypted bool
+	for _, s := range res.Strings {
+		encrypted = encrypted || s.Value == "encrypted text"
+	}
+	if !encrypted {
+		t.Error("an encrypted string is not listed")
+	}
+}
@@ -0,0 +1,220 @@
+package obfuscator
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"strings"
+)
+
+// A Policy decides which packages, names and strings are
+// obfuscated. It is usually read from a JSON file with
+// ReadPolicy.
+//
+// Packages are matched with patterns like those of the go
+// command, where "..." matches any string, so that
+// "example.com/lib/..." matches example.com/lib and all of
+// the packages inside of it.
+//
+// A nil *Policy obfuscates everything.
+type Policy struct {
+	// Rename lists the packages whose paths and symbols are
+	// renamed. If it is empty, every package is renamed.
+	Rename []string `json:"rename,omitempty"`
+
+	// Encrypt lists the packages whose strings are
+	// encrypted. If it is empty, every package's strings
+	// are encrypted.
+	Encrypt []string `json:"encrypt,omitempty"`
+
+	// Ignore lists the packages which are left alone
+	// entirely, regardless of Rename and Encrypt.
+	// Their imports of other packages are still updated.
+	Ignore []string `json:"ignore,omitempty"`
+
+	// Keep lists names which are never renamed, either as
+	// bare identifiers like "Config" or as qualified names
+	// like "example.com/pkg.Config", "example.com/pkg.T.Field"
+	// or "example.com/pkg.(*T).Method".
+	Keep []string `json:"keep,omitempty"`
+
+	// KeepPatterns lists regular expressions, and qualified
+	// names which match any of them are never renamed.
+	KeepPatterns []string `json:"keepPatterns,omitempty"`
+
+	// ExcludeStrings lists regular expressions, and string
+	// literals which match any of them are not encrypted.
+	ExcludeStrings []string `json:"excludeStrings,omitempty"`
+
+	// Tags and Platforms are used like the -tags and
+	// -platforms flags.
+	Tags      string `json:"tags,omitempty"`
+	Platforms string `json:"platforms,omitempty"`
+
+	Output PolicyOutput `json:"output"`
+
+	compiled     bool
+	keepExprs    []*regexp.Regexp
+	excludeExprs []*regexp.Regexp
+}
+
+// PolicyOutput configures the output of an obfuscation,
+// like the corresponding command-line flags.
+type PolicyOutput struct {
+	// Mode is "binary", "gopath" or "module".
+	Mode string `json:"mode,omitempty"`
+
+	KeepTests    bool `json:"keepTests,omitempty"`
+	WinHide      bool `json:"winHide,omitempty"`
+	NoStaticLink bool `json:"noStatic,omitempty"`
+}
+
+// ReadPolicy loads a JSON policy and checks its patterns.
+func ReadPolicy(path string) (*Policy, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var p Policy
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, fmt.Errorf("parse policy: %s", err)
+	}
+	if err := p.compile(); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// OutputMode parses the output mode of the policy, which
+// defaults to OutputBinary.
+func (p *Policy) OutputMode() (OutputMode, error) {
+	switch p.Output.Mode {
+	case "", "binary":
+		return OutputBinary, nil
+	case "gopath":
+		return OutputGopath, nil
+	case "module":
+		return OutputModule, nil
+	}
+	return 0, fmt.Errorf("unknown output mode: %q", p.Output.Mode)
+}
+
+// Moved creates a copy of the policy which also matches
+// the new paths of moved packages, so that it can be used
+// on a GOPATH after its packages have been renamed.
+func (p *Policy) Moved(packages map[string]string) *Policy {
+	if p == nil {
+		return nil
+	}
+	res := *p
+	res.Encrypt = append([]string{}, p.Encrypt...)
+	for oldPath, newPath := range packages {
+		if len(p.Encrypt) > 0 && matchPackages(p.Encrypt, oldPath) {
+			res.Encrypt = append(res.Encrypt, newPath)
+		}
+	}
+	return &res
+}
+
+func (p *Policy) compile() error {
+	if p == nil || p.compiled {
+		return nil
+	}
+	for _, list := range [][]string{p.Rename, p.Encrypt, p.Ignore} {
+		for _, pattern := range list {
+			if _, err := packagePattern(pattern); err != nil {
+				return err
+			}
+		}
+	}
+	for _, expr := range p.KeepPatterns {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return fmt.Errorf("keep pattern: %s", err)
+		}
+		p.keepExprs = append(p.keepExprs, re)
+	}
+	for _, expr := range p.ExcludeStrings {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return fmt.Errorf("string exclusion: %s", err)
+		}
+		p.excludeExprs = append(p.excludeExprs, re)
+	}
+	p.compiled = true
+	return nil
+}
+
+// renames checks if the path and symbols of a package are
+// renamed.
+func (p *Policy) renames(pkgPath string) bool {
+	if p == nil {
+		return true
+	}
+	return !matchPackages(p.Ignore, pkgPath) && (len(p.Rename) == 0 || matchPackages(p.Rename, pkgPath))
+}
+
+// encrypts checks if the strings of a package are
+// encrypted.
+func (p *Policy) encrypts(pkgPath string) bool {
+	if p == nil {
+		return true
+	}
+	return !matchPackages(p.Ignore, pkgPath) && (len(p.Encrypt) == 0 || matchPackages(p.Encrypt, pkgPath))
+}
+
+// keeps checks if a name is kept, given its identifier and
+// qualified name.
+func (p *Policy) keeps(name, qualified string) bool {
+	if p == nil {
+		return false
+	}
+	for _, keep := range p.Keep {
+		if keep == name || keep == qualified {
+			return true
+		}
+	}
+	for _, re := range p.keepExprs {
+		if re.MatchString(qualified) {
+			return true
+		}
+	}
+	return false
+}
+
+// excludesString checks if a string literal is left alone.
+func (p *Policy) excludesString(s string) bool {
+	if p == nil {
+		return false
+	}
+	for _, re := range p.excludeExprs {
+		if re.MatchString(s) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchPackages(patterns []string, pkgPath string) bool {
+	for _, pattern := range patterns {
+		if re, err := packagePattern(pattern); err == nil && re.MatchString(pkgPath) {
+			return true
+		}
+	}
+	return false
+}
+
+// packagePattern compiles a package pattern, in which a
+// trailing "/..." also matches the path without it.
+func packagePattern(pattern string) (*regexp.Regexp, error) {
+	if pattern == "" {
+		return nil, fmt.Errorf("empty package pattern")
+	}
+	expr := regexp.QuoteMeta(pattern)
+	expr = strings.Replace(expr, `\.\.\.`, `.*`, -1)
+	if strings.HasSuffix(expr, `/.*`) {
+		expr = strings.TrimSuffix(expr, `/.*`) + `(/.*)?`
+	}
+	return regexp.Compile("^" + expr + "$")
+}
@@ -0,0 +1,37 @@
+package obfuscator
+
+import "testing"
+
+func TestPackagePattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string
+		match   bool
+	}{
+		{"example.com/a", "example.com/a", true},
+		{"example.com/a", "example.com/a/b", false},
+		{"example.com/a", "example.com/ab", false},
+		{"example.com/a/...", "example.com/a", true},
+		{"example.com/a/...", "example.com/a/b/c", true},
+		{"example.com/a/...", "example.com/ab", false},
+		{"example.com/.../internal", "example.com/x/y/internal", true},
+		{"example.com/.../internal", "example.com/x/internal/z", false},
+		{"...", "anything/at/all", true},
+		{"example.com/a.b", "example.com/axb", false},
+		{"example.com/a+b", "example.com/a+b", true},
+	}
+	for _, test := range tests {
+		re, err := packagePattern(test.pattern)
+		if err != nil {
+			t.Errorf("packagePattern(%q): %s", test.pattern, err)
+			continue
+		}
+		if actual := re.MatchString(test.path); actual != test.match {
+			t.Errorf("pattern %q on %q: got %v, expected %v", test.pattern, test.path, actual,
+				test.match)
+		}
+	}
+	if _, err := packagePattern(""); err == nil {
+		t.Error("expected an error for an empty pattern")
+	}
+}
@@ -0,0 +1,450 @@
+package obfuscator
+
+import (
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/token"
+	"go/types"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// A Renamer computes package moves and symbol renames for
+// an entire Workspace, and applies them as a single set of
+// edits.
+type Renamer struct {
+	Workspace *Workspace
+	Hasher    NameHasher
+
+	// Variants are workspaces for other build configurations
+	// of the same GOPATH, which share the FileSet of
+	// Workspace.
+	// Every declaration gets the same new name in all of
+	// them, and files which are only part of a variant are
+	// renamed as well.
+	Variants []*Workspace
+
+	// Objects maps declared objects to their new names.
+	Objects map[types.Object]string
+
+	// Packages maps import paths to new import paths.
+	Packages map[string]string
+
+	// Dirs maps package and module directories to the
+	// directories they are moved to.
+	Dirs map[string]string
+
+	// KeepPaths lists import paths which RenamePackages
+	// does not move.
+	KeepPaths map[string]bool
+
+	// Policy, if non-nil, restricts the packages and names
+	// which are renamed.
+	Policy *Policy
+
+	// InjectTags enables renaming the fields of struct types
+	// which only reach TagEncoders, by adding struct tags
+	// with their original names.
+	InjectTags bool
+
+	// Tags maps struct fields to new struct tags.
+	Tags map[*ast.Field]string
+
+	// Skipped lists the names which were deliberately not
+	// renamed, along with the reasons.
+	Skipped []*Skip
+
+	// Linknames lists the //go:linkname directives which are
+	// rewritten to use new names.
+	Linknames []*Linkname
+
+	// owners maps struct fields to the types that declare
+	// them.
+	owners map[*types.Var]*types.TypeName
+
+	// fieldDecls maps struct fields to their declarations,
+	// and fieldTags maps the fields which need injected tags
+	// to the keys of those tags.
+	fieldDecls map[*types.Var]*ast.Field
+	fieldTags  map[*types.Var][]string
+
+	checkedFiles    map[string]bool
+	excluded        map[string][]*excludedFile
+	excludedDecls   map[string]map[string]string
+	excludedMembers *excludedMembers
+
+	linknameIgnored map[string]map[string]string
+	ignoredPackages map[string]bool
+	linknameEdits   map[*ast.Comment]string
+
+	imported        *Mapping
+	importedPaths   map[string]string
+	importedSymbols map[string]string
+}
+
+// A Skip records a name which was deliberately not
+// renamed.
+type Skip struct {
+	Kind     NameKind `json:"kind"`
+	Name     string   `json:"name"`
+	Position string   `json:"position,omitempty"`
+	Reason   string   `json:"reason"`
+}
+
+// NewRenamer loads the workspace for a GOPATH and creates
+// a Renamer with no pending renames.
+//
+// If build configurations are given, the workspace is
+// loaded for the first one, and variants are loaded for
+// the rest.
+func NewRenamer(gopath string, n NameHasher, configs ...BuildConfig) (*Renamer, error) {
+	if len(configs) == 0 {
+		configs = []BuildConfig{{}}
+	}
+	fset := token.NewFileSet()
+	var workspaces []*Workspace
+	for _, config := range configs {
+		w, err := LoadWorkspaceConfig(gopath, config, fset)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", config, err)
+		}
+		workspaces = append(workspaces, w)
+	}
+	return &Renamer{
+		Workspace:  workspaces[0],
+		Variants:   workspaces[1:],
+		Hasher:     n,
+		Objects:    map[types.Object]string{},
+		Packages:   map[string]string{},
+		Dirs:       map[string]string{},
+		KeepPaths:  map[string]bool{},
+		Tags:       map[*ast.Field]string{},
+		owners:     map[*types.Var]*types.TypeName{},
+		fieldDecls: map[*types.Var]*ast.Field{},
+		fieldTags:  map[*types.Var][]string{},
+		excluded:   map[string][]*excludedFile{},
+
+		linknameEdits: map[*ast.Comment]string{},
+	}, nil
+}
+
+// workspaces lists the workspace and all of its variants.
+func (r *Renamer) workspaces() []*Workspace {
+	return append([]*Workspace{r.Workspace}, r.Variants...)
+}
+
+// isChecked checks if a file is type-checked in any of the
+// workspaces.
+func (r *Renamer) isChecked(path string) bool {
+	if r.checkedFiles == nil {
+		r.checkedFiles = map[string]bool{}
+		for _, w := range r.workspaces() {
+			for _, pkg := range w.Packages {
+				for _, file := range pkg.Files {
+					r.checkedFiles[r.Workspace.Fset.File(file.Pos()).Name()] = true
+				}
+			}
+		}
+	}
+	return r.checkedFiles[path]
+}
+
+// Apply rewrites every source file affected by the pending
+// renames, including assembly, and then moves package
+// directories.
+//
+// Files which are part of several workspaces are edited
+// through the first workspace that contains them.
+func (r *Renamer) Apply() error {
+	edited := map[string]bool{}
+	for _, w := range r.workspaces() {
+		for _, pkg := range w.SortedPackages() {
+			for _, file := range pkg.Files {
+				path := r.Workspace.Fset.File(file.Pos()).Name()
+				if edited[path] {
+					continue
+				}
+				edited[path] = true
+				edits := r.fileEdits(pkg, file)
+				if len(edits) == 0 {
+					continue
+				}
+				if err := r.editFile(file, edits); err != nil {
+					return err
+				}
+			}
+			if !pkg.XTest && !edited[pkg.Build.Dir] {
+				edited[pkg.Build.Dir] = true
+				if err := r.applyAsm(pkg); err != nil {
+					return err
+				}
+				if err := r.applyExcluded(pkg); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return r.moveDirs()
+}
+
+type edit struct {
+	Start int
+	End   int
+	Text  string
+}
+
+func (r *Renamer) fileEdits(pkg *WorkspacePackage, file *ast.File) []edit {
+	var edits []edit
+	add := func(node ast.Node, text string) {
+		edits = append(edits, edit{
+			Start: r.Workspace.Fset.Position(node.Pos()).Offset,
+			End:   r.Workspace.Fset.Position(node.End()).Offset,
+			Text:  text,
+		})
+	}
+
+	if newPath, ok := r.Packages[pkg.Build.ImportPath]; ok && pkg.Types.Name() != "main" {
+		name := importPathName(newPath)
+		if pkg.XTest {
+			name += "_test"
+		}
+		add(file.Name, name)
+		if comment := importComment(r.Workspace.Fset, file); comment != nil {
+			add(comment, "// import "+strconv.Quote(newPath))
+		}
+	}
+
+	for _, spec := range file.Imports {
+		if newPath := r.importSpecPath(pkg, spec); newPath != "" {
+			add(spec.Path, strconv.Quote(newPath))
+		}
+	}
+
+	for _, l := range fileLinknames(file) {
+		if text, ok := r.linknameEdits[l.Comment]; ok {
+			add(l.Comment, text)
+		}
+	}
+
+	ast.Inspect(file, func(n ast.Node) bool {
+		if field, ok := n.(*ast.Field); ok {
+			if tag, ok := r.Tags[field]; ok {
+				if field.Tag != nil {
+					add(field.Tag, quoteTag(tag))
+				} else {
+					end := r.Workspace.Fset.Position(field.Type.End()).Offset
+					edits = append(edits, edit{Start: end, End: end, Text: " " + quoteTag(tag)})
+				}
+			}
+			return true
+		}
+		ident, ok := n.(*ast.Ident)
+		if !ok {
+			return true
+		}
+		if obj, ok := pkg.Info.Defs[ident]; ok && obj != nil {
+			if name, ok := r.newName(obj); ok {
+				add(ident, name)
+				return true
+			}
+		}
+		if obj, ok := pkg.Info.Uses[ident]; ok {
+			if name, ok := r.newName(obj); ok {
+				add(ident, name)
+			}
+		}
+		return true
+	})
+
+	return edits
+}
+
+// newName finds the new name for an object, if it is
+// being renamed.
+//
+// Methods and fields of instantiated generic types are
+// renamed along with their generic origins.
+func (r *Renamer) newName(obj types.Object) (string, bool) {
+	switch o := obj.(type) {
+	case *types.Func:
+		obj = o.Origin()
+	case *types.Var:
+		obj = o.Origin()
+	}
+	switch obj := obj.(type) {
+	case *types.PkgName:
+		if newPath, ok := r.Packages[obj.Imported().Path()]; ok {
+			return importPathName(newPath), obj.Name() == obj.Imported().Name()
+		}
+		return "", false
+	case *types.Var:
+		if obj.Embedded() {
+			// Embedded fields are named after their types.
+			if named := embeddedTypeName(obj.Type()); named != nil {
+				return r.newName(named)
+			}
+		}
+	}
+	name, ok := r.Objects[obj]
+	return name, ok
+}
+
+// importSpecPath gets the new path for an import spec, or
+// "" if the imported package is not being moved.
+func (r *Renamer) importSpecPath(pkg *WorkspacePackage, spec *ast.ImportSpec) string {
+	obj := pkg.Info.Implicits[spec]
+	if spec.Name != nil && pkg.Info.Defs[spec.Name] != nil {
+		obj = pkg.Info.Defs[spec.Name]
+	}
+	pkgName, ok := obj.(*types.PkgName)
+	if !ok {
+		return ""
+	}
+	newPath, ok := r.Packages[pkgName.Imported().Path()]
+	if !ok {
+		return ""
+	}
+	return newPath
+}
+
+func (r *Renamer) editFile(file *ast.File, edits []edit) error {
+	path := r.Workspace.Fset.File(file.Pos()).Name()
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	result := applyEdits(contents, edits)
+	if formatted, err := format.Source(result); err == nil {
+		result = formatted
+	}
+	return ioutil.WriteFile(path, result, 0755)
+}
+
+// applyEdits applies edits to the contents of a file.
+func applyEdits(contents []byte, edits []edit) []byte {
+	sort.Slice(edits, func(i, j int) bool {
+		return edits[i].Start < edits[j].Start
+	})
+
+	var result []byte
+	var lastIdx int
+	for _, e := range edits {
+		if e.Start < lastIdx {
+			// The same identifier may be both defined and used,
+			// as is the case for embedded fields.
+			continue
+		}
+		result = append(result, contents[lastIdx:e.Start]...)
+		result = append(result, e.Text...)
+		lastIdx = e.End
+	}
+	return append(result, contents[lastIdx:]...)
+}
+
+// moveDirs moves the contents of every renamed directory
+// to its new location.
+//
+// Sub-directories are moved along with their parent unless
+// they contain (or will contain) other packages, and any
+// directories left empty are removed afterwards.
+func (r *Renamer) moveDirs() error {
+	protected := map[string]bool{}
+	protect := func(dir string) {
+		for ; dir != r.Workspace.Gopath && !protected[dir]; dir = filepath.Dir(dir) {
+			protected[dir] = true
+		}
+	}
+	for _, w := range r.workspaces() {
+		for _, pkg := range w.Packages {
+			protect(pkg.Build.Dir)
+		}
+	}
+	for oldDir, newDir := range r.Dirs {
+		protect(oldDir)
+		protect(newDir)
+	}
+
+	for oldDir, newDir := range r.Dirs {
+		if err := os.MkdirAll(newDir, 0755); err != nil {
+			return err
+		}
+		listing, err := ioutil.ReadDir(oldDir)
+		if err != nil {
+			return err
+		}
+		for _, item := range listing {
+			oldPath := filepath.Join(oldDir, item.Name())
+			if item.IsDir() && protected[oldPath] {
+				continue
+			}
+			if err := os.Rename(oldPath, filepath.Join(newDir, item.Name())); err != nil {
+				return err
+			}
+		}
+	}
+	return removeEmptyDirs(filepath.Join(r.Workspace.Gopath, "src"))
+}
+
+// removeEmptyDirs removes every directory inside of dir
+// which contains no files.
+func removeEmptyDirs(dir string) error {
+	listing, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, item := range listing {
+		if !item.IsDir() {
+			continue
+		}
+		sub := filepath.Join(dir, item.Name())
+		if err := removeEmptyDirs(sub); err != nil {
+			return err
+		}
+		if subListing, err := ioutil.ReadDir(sub); err == nil && len(subListing) == 0 {
+			if err := os.Remove(sub); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// embeddedTypeName finds the named type behind the type of
+// an embedded field.
+func embeddedTypeName(t types.Type) *types.TypeName {
+	if ptr, ok := t.(*types.Pointer); ok {
+		t = ptr.Elem()
+	}
+	switch t := t.(type) {
+	case *types.Named:
+		return t.Obj()
+	case *types.Alias:
+		return t.Obj()
+	}
+	return nil
+}
+
+func importPathName(path string) string {
+	return strings.TrimSuffix(path[strings.LastIndex(path, "/")+1:], hashedDomainSuffix)
+}
+
+// importComment finds the import comment on the package
+// clause of a file, if there is one.
+func importComment(fset *token.FileSet, file *ast.File) *ast.Comment {
+	line := fset.Position(file.Name.End()).Line
+	for _, group := range file.Comments {
+		c := group.List[0]
+		if c.Pos() < file.Name.End() || fset.Position(c.Pos()).Line != line {
+			continue
+		}
+		if strings.HasPrefix(c.Text, `// import "`) || strings.HasPrefix(c.Text, `/* import "`) {
+			return c
+		}
+	}
+	return nil
+}
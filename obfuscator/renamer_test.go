@@ -0,0 +1,30 @@
+package obfuscator
+
+import "testing"
+
+func TestApplyEdits(t *testing.T) {
+	tests := []struct {
+		contents string
+		edits    []edit
+		expected string
+	}{
+		{"hello world", nil, "hello world"},
+		{"hello world", []edit{{0, 5, "bye"}}, "bye world"},
+		{"hello world", []edit{{6, 11, "there"}, {0, 5, "hi"}}, "hi there"},
+		{"a.b", []edit{{1, 1, "xyz"}}, "axyz.b"},
+		{"abc", []edit{{0, 3, ""}}, ""},
+		{"abc", []edit{{3, 3, "!"}}, "abc!"},
+
+		// Overlapping edits after the first one are skipped.
+		{"type T struct{ T }", []edit{{15, 16, "X"}, {15, 16, "Y"}}, "type T struct{ X }"},
+		{"abcdef", []edit{{0, 4, "W"}, {2, 3, "Z"}, {4, 6, "Q"}}, "WQ"},
+	}
+	for _, test := range tests {
+		edits := append([]edit{}, test.edits...)
+		actual := string(applyEdits([]byte(test.contents), edits))
+		if actual != test.expected {
+			t.Errorf("applyEdits(%q, %v) = %q, expected %q", test.contents, test.edits, actual,
+				test.expected)
+		}
+	}
+}
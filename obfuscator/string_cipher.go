@@ -0,0 +1,353 @@
+package obfuscator
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"fmt"
+	"go/ast"
+	"go/build/constraint"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"math/rand"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// stringKey derives the AES key for the strings of a
+// package from the padding.
+func stringKey(n NameHasher, pkgPath string) []byte {
+	mac := hmac.New(sha256.New, n)
+	mac.Write([]byte("gobfuscate string key\x00" + pkgPath))
+	return mac.Sum(nil)
+}
+
+// An aesStrings encrypts the strings of a package with
+// AES-CTR, for a helper file which decrypts them.
+//
+// If Table is set, the strings are gathered into one blob
+// instead, and every literal becomes a call to an accessor
+// which decrypts and caches its entry the first time it is
+// called.
+type aesStrings struct {
+	PkgName string
+	Block   cipher.Block
+	Key     []byte
+	Table   bool
+	Rand    *rand.Rand
+
+	// Strings and Indices are the entries of the table.
+	Strings []string
+	Indices map[string]int
+
+	// Names of the generated declarations and imports.
+	Decrypt, ShareA, ShareB        string
+	Blob, IV, Offsets, Cache, Once string
+	BlockOnce, BlockVar            string
+	AES, Cipher, SHA256, Sync      string
+}
+
+func newAESStrings(n NameHasher, pkgPath, pkgName string, table bool, r *rand.Rand) *aesStrings {
+	key := stringKey(n, pkgPath)
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		panic(err)
+	}
+	name := func(kind NameKind, token string) string {
+		return n.Hash(pkgPath, kind, token)
+	}
+	return &aesStrings{
+		PkgName:   pkgName,
+		Block:     block,
+		Key:       key,
+		Table:     table,
+		Rand:      r,
+		Indices:   map[string]int{},
+		Decrypt:   name(KindFunc, "decryptString"),
+		ShareA:    name(KindVar, "stringKeyA"),
+		ShareB:    name(KindVar, "stringKeyB"),
+		Blob:      name(KindVar, "stringBlob"),
+		IV:        name(KindVar, "stringIV"),
+		Offsets:   name(KindVar, "stringOffsets"),
+		Cache:     name(KindVar, "stringCache"),
+		Once:      name(KindVar, "stringOnce"),
+		BlockOnce: name(KindVar, "stringBlockOnce"),
+		BlockVar:  name(KindVar, "stringBlock"),
+		AES:       name(KindPackage, "aes"),
+		Cipher:    name(KindPackage, "cipher"),
+		SHA256:    name(KindPackage, "sha256"),
+		Sync:      name(KindPackage, "sync"),
+	}
+}
+
+// LiteralCode encrypts a string with a random IV, and
+// produces an expression which decrypts it.
+// For a table, it adds the string to the table instead,
+// and produces a call to the accessor.
+func (a *aesStrings) LiteralCode(str string) []byte {
+	if a.Table {
+		idx, ok := a.Indices[str]
+		if !ok {
+			idx = len(a.Strings)
+			a.Indices[str] = idx
+			a.Strings = append(a.Strings, str)
+		}
+		return []byte(fmt.Sprintf("%s(%d)", a.Decrypt, idx))
+	}
+	iv := make([]byte, aes.BlockSize)
+	a.Rand.Read(iv)
+	data := make([]byte, len(str))
+	cipher.NewCTR(a.Block, iv).XORKeyStream(data, []byte(str))
+	return []byte(fmt.Sprintf("%s([]byte(\"%s\"), []byte(\"%s\"))", a.Decrypt, hexEscape(iv),
+		hexEscape(data)))
+}
+
+// HelperCode produces a file which declares the decryption
+// function, or the table and its accessor.
+//
+// The key is not stored as is: it is the SHA-256 hash of
+// one random share XORed with another share. Both shares
+// are in the file, so this only hides the key (and the
+// strings) from a plain scan of the binary.
+func (a *aesStrings) HelperCode() []byte {
+	shareA := make([]byte, 32)
+	a.Rand.Read(shareA)
+	hashA := sha256.Sum256(shareA)
+	shareB := make([]byte, 32)
+	for i := range shareB {
+		shareB[i] = hashA[i] ^ a.Key[i]
+	}
+
+	var res bytes.Buffer
+	fmt.Fprintf(&res, "package %s\n\n", a.PkgName)
+	fmt.Fprintf(&res, "import (\n%s \"crypto/aes\"\n%s \"crypto/cipher\"\n%s \"crypto/sha256\"\n",
+		a.AES, a.Cipher, a.SHA256)
+	if a.Table {
+		fmt.Fprintf(&res, "%s \"sync\"\n", a.Sync)
+	}
+	res.WriteString(")\n\n")
+	fmt.Fprintf(&res, "var %s = []byte(\"%s\")\n\n", a.ShareA, hexEscape(shareA))
+	fmt.Fprintf(&res, "var %s = []byte(\"%s\")\n\n", a.ShareB, hexEscape(shareB))
+	if a.Table {
+		a.writeTable(&res)
+	} else {
+		fmt.Fprintf(&res, `func %s(iv, data []byte) string {
+	key := %s.Sum256(%s)
+	for i := range key {
+		key[i] ^= %s[i]
+	}
+	block, _ := %s.NewCipher(key[:])
+	res := make([]byte, len(data))
+	%s.NewCTR(block, iv).XORKeyStream(res, data)
+	return string(res)
+}
+`, a.Decrypt, a.SHA256, a.ShareA, a.ShareB, a.AES, a.Cipher)
+	}
+	formatted, err := format.Source(res.Bytes())
+	if err != nil {
+		panic(err)
+	}
+	return formatted
+}
+
+// writeTable writes the blob, which is the concatenation of
+// the strings encrypted as one AES-CTR stream, along with
+// the accessor.
+//
+// Since the stream is in counter mode, the accessor can
+// decrypt an entry on its own by advancing the IV to the
+// block that the entry starts in.
+func (a *aesStrings) writeTable(w *bytes.Buffer) {
+	iv := make([]byte, aes.BlockSize)
+	a.Rand.Read(iv)
+	var plain []byte
+	offsets := []string{"0"}
+	for _, str := range a.Strings {
+		plain = append(plain, str...)
+		offsets = append(offsets, strconv.Itoa(len(plain)))
+	}
+	blob := make([]byte, len(plain))
+	cipher.NewCTR(a.Block, iv).XORKeyStream(blob, plain)
+
+	fmt.Fprintf(w, "var %s = []byte(\"%s\")\n\n", a.Blob, hexEscape(blob))
+	fmt.Fprintf(w, "var %s = []byte(\"%s\")\n\n", a.IV, hexEscape(iv))
+	fmt.Fprintf(w, "var %s = [...]int{%s}\n\n", a.Offsets, strings.Join(offsets, ", "))
+	fmt.Fprintf(w, "var %s [%d]string\n\n", a.Cache, len(a.Strings))
+	fmt.Fprintf(w, "var %s [%d]%s.Once\n\n", a.Once, len(a.Strings), a.Sync)
+	fmt.Fprintf(w, "var %s %s.Once\n\n", a.BlockOnce, a.Sync)
+	fmt.Fprintf(w, "var %s %s.Block\n\n", a.BlockVar, a.Cipher)
+	fmt.Fprintf(w, `func %[1]s(i int) string {
+	%[2]s[i].Do(func() {
+		%[3]s.Do(func() {
+			key := %[4]s.Sum256(%[5]s)
+			for j := range key {
+				key[j] ^= %[6]s[j]
+			}
+			%[7]s, _ = %[8]s.NewCipher(key[:])
+		})
+		start, end := %[9]s[i], %[9]s[i+1]
+		iv := make([]byte, len(%[10]s))
+		copy(iv, %[10]s)
+		carry := start / len(iv)
+		for j := len(iv) - 1; j >= 0; j-- {
+			carry += int(iv[j])
+			iv[j] = byte(carry)
+			carry >>= 8
+		}
+		skip := start %% len(iv)
+		res := make([]byte, skip+end-start)
+		copy(res[skip:], %[11]s[start:end])
+		%[12]s.NewCTR(%[7]s, iv).XORKeyStream(res, res)
+		%[13]s[i] = string(res[skip:])
+	})
+	return %[13]s[i]
+}
+`, a.Decrypt, a.Once, a.BlockOnce, a.SHA256, a.ShareA, a.ShareB, a.BlockVar, a.AES,
+		a.Offsets, a.IV, a.Blob, a.Cipher, a.Cache)
+}
+
+// encryptDirStrings encrypts the strings in the Go files of
+// a directory with AES, adding a helper file for the
+// package and for its external test package.
+// If table is set, the strings of each are gathered into a
+// table.
+//
+// Files which belong to neither, such as programs excluded
+// by an "ignore" build tag, are encoded by encoder, whose
+// RNG is used for the encryption as well.
+func encryptDirStrings(srcDir string, paths []string, n NameHasher, policy *Policy, table bool,
+	encoder *stringEncoder, uses map[string][]*constUse) error {
+	dir := filepath.Dir(paths[0])
+	rel, err := filepath.Rel(srcDir, dir)
+	if err != nil {
+		return err
+	}
+	pkgPath := filepath.ToSlash(rel)
+
+	names := map[string]string{}
+	var pkgNames []string
+	for _, path := range paths {
+		file, err := parser.ParseFile(token.NewFileSet(), path, nil,
+			parser.PackageClauseOnly|parser.ParseComments)
+		if err != nil {
+			continue
+		}
+		names[path] = file.Name.Name
+		if !strings.HasSuffix(path, "_test.go") && mayBuild(file) {
+			pkgNames = append(pkgNames, file.Name.Name)
+		}
+	}
+	pkgName := mostCommon(pkgNames)
+
+	helpers := map[string]*aesStrings{}
+	used := map[string]bool{}
+	for _, path := range paths {
+		name := names[path]
+		encode := encoder.Code
+		if pkgName != "" && (name == pkgName || (name == pkgName+"_test" && strings.HasSuffix(path, "_test.go"))) {
+			if helpers[name] == nil {
+				suffix := strings.TrimPrefix(name, pkgName)
+				helpers[name] = newAESStrings(n, pkgPath+suffix, name, table, encoder.Rand)
+			}
+			encode = helpers[name].LiteralCode
+		}
+		count, err := obfuscateFileStrings(path, policy, encode, uses[path])
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			used[name] = true
+		}
+	}
+
+	var helperNames []string
+	for name := range helpers {
+		if used[name] {
+			helperNames = append(helperNames, name)
+		}
+	}
+	sort.Strings(helperNames)
+	for _, name := range helperNames {
+		helper := helpers[name]
+		fileName := n.Hash(pkgPath, KindPackage, name+" strings") + ".go"
+		if name != pkgName {
+			fileName = strings.TrimSuffix(fileName, ".go") + "_test.go"
+		}
+		if err := ioutil.WriteFile(filepath.Join(dir, fileName), helper.HelperCode(), 0755); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// mayBuild checks if the build constraints of a file can be
+// satisfied by any set of tags which does not include
+// "ignore".
+func mayBuild(file *ast.File) bool {
+	for _, group := range file.Comments {
+		if group.Pos() >= file.Package {
+			break
+		}
+		for _, c := range group.List {
+			if !constraint.IsGoBuild(c.Text) && !constraint.IsPlusBuild(c.Text) {
+				continue
+			}
+			expr, err := constraint.Parse(c.Text)
+			if err == nil && !satisfiable(expr) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func satisfiable(expr constraint.Expr) bool {
+	var tags []string
+	seen := map[string]bool{}
+	expr.Eval(func(tag string) bool {
+		if !seen[tag] && tag != "ignore" {
+			seen[tag] = true
+			tags = append(tags, tag)
+		}
+		return false
+	})
+	if len(tags) > 16 {
+		return true
+	}
+	for mask := 0; mask < 1<<uint(len(tags)); mask++ {
+		set := map[string]bool{}
+		for i, tag := range tags {
+			set[tag] = mask&(1<<uint(i)) != 0
+		}
+		if expr.Eval(func(tag string) bool { return set[tag] }) {
+			return true
+		}
+	}
+	return false
+}
+
+func mostCommon(strs []string) string {
+	counts := map[string]int{}
+	var res string
+	for _, s := range strs {
+		counts[s]++
+		if counts[s] > counts[res] || (counts[s] == counts[res] && s < res) {
+			res = s
+		}
+	}
+	return res
+}
+
+func hexEscape(data []byte) string {
+	var res strings.Builder
+	for _, b := range data {
+		fmt.Fprintf(&res, "\\x%02x", b)
+	}
+	return res.String()
+}
@@ -0,0 +1,158 @@
+package obfuscator
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testStrings cover empty strings, multi-byte characters,
+// and entries which start and end in the middle of AES
+// blocks.
+var testStrings = []string{
+	"",
+	"a",
+	"hello, world",
+	"héllo ✓ \x00\xff",
+	"0123456789abcdef",
+	"0123456789abcdef0",
+	strings.Repeat("long string ", 40),
+	"tail",
+}
+
+// onesSource makes every random byte 0xff, so that table
+// IVs overflow as soon as they are advanced.
+type onesSource struct{}
+
+func (onesSource) Int63() int64 { return 1<<63 - 1 }
+func (onesSource) Seed(int64)   {}
+
+func TestStringCiphers(t *testing.T) {
+	var helpers []string
+	var exprs []string
+	var expected []string
+	addExpr := func(expr, value string) {
+		exprs = append(exprs, expr)
+		expected = append(expected, value)
+	}
+
+	encoder := &stringEncoder{Rand: rand.New(rand.NewSource(1))}
+	for _, str := range testStrings {
+		addExpr(string(encoder.Code(str)), str)
+	}
+
+	rngs := []*rand.Rand{rand.New(rand.NewSource(2)), rand.New(onesSource{})}
+	for i, r := range rngs {
+		for _, table := range []bool{false, true} {
+			pkgPath := fmt.Sprintf("example.com/p%d/%v", i, table)
+			a := newAESStrings(NameHasher("test"), pkgPath, "main", table, r)
+			for _, str := range testStrings {
+				addExpr(string(a.LiteralCode(str)), str)
+			}
+			// Repeated strings share an entry of the table.
+			addExpr(string(a.LiteralCode(testStrings[2])), testStrings[2])
+			helpers = append(helpers, string(a.HelperCode()))
+		}
+	}
+
+	output := runStringProgram(t, helpers, exprs)
+	if len(output) != len(expected) {
+		t.Fatalf("expected %d lines, got %d", len(expected), len(output))
+	}
+	for i, line := range output {
+		if line != fmt.Sprintf("%q", expected[i]) {
+			t.Errorf("expression %d: got %s, expected %q", i, line, expected[i])
+		}
+	}
+}
+
+func TestStringSchemes(t *testing.T) {
+	encoder := &stringEncoder{Rand: rand.New(rand.NewSource(3))}
+	schemes := map[string]func(string) string{
+		"xor":     encoder.xor,
+		"rolling": encoder.rolling,
+		"rotate":  encoder.rotate,
+		"shuffle": encoder.shuffle,
+		"split":   encoder.split,
+	}
+	var names []string
+	var exprs []string
+	var expected []string
+	for _, name := range []string{"xor", "rolling", "rotate", "shuffle", "split"} {
+		for _, str := range testStrings {
+			if name == "split" && len(str) < 2 {
+				continue
+			}
+			// Each scheme picks its shapes at random, so it is
+			// tried a few times.
+			for i := 0; i < 4; i++ {
+				names = append(names, name)
+				exprs = append(exprs, schemes[name](str))
+				expected = append(expected, str)
+			}
+		}
+	}
+
+	output := runStringProgram(t, nil, exprs)
+	if len(output) != len(expected) {
+		t.Fatalf("expected %d lines, got %d", len(expected), len(output))
+	}
+	for i, line := range output {
+		if line != fmt.Sprintf("%q", expected[i]) {
+			t.Errorf("%s: got %s, expected %q", names[i], line, expected[i])
+		}
+	}
+}
+
+// runStringProgram builds and runs a program which prints
+// every expression with %q on its own line, along with the
+// given helper files.
+func runStringProgram(t *testing.T, helpers, exprs []string) []string {
+	if testing.Short() {
+		t.Skip("skipping compilation in short mode")
+	}
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go command not found")
+	}
+	dir, err := ioutil.TempDir("", "gobfuscate_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var main bytes.Buffer
+	main.WriteString("package main\n\nimport \"fmt\"\n\nfunc main() {\n")
+	for _, expr := range exprs {
+		fmt.Fprintf(&main, "fmt.Printf(\"%%q\\n\", %s)\n", expr)
+	}
+	main.WriteString("}\n")
+	files := map[string]string{
+		"go.mod":  "module example.com/strings\n\ngo 1.22\n",
+		"main.go": main.String(),
+	}
+	for i, helper := range helpers {
+		files[fmt.Sprintf("helper%d.go", i)] = helper
+	}
+	for name, contents := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cmd := exec.Command("go", "run", ".")
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GOFLAGS=", "GOWORK=off", "GO111MODULE=on")
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("go run: %s\n%s", err, stderr.String())
+	}
+	return strings.Split(strings.TrimSuffix(stdout.String(), "\n"), "\n")
+}
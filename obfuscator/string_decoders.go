@@ -0,0 +1,258 @@
+package obfuscator
+
+import (
+	"bytes"
+	"fmt"
+	"go/token"
+	"go/types"
+	"math/rand"
+	"strings"
+)
+
+// A stringEncoder replaces string literals with closures
+// which decode them.
+//
+// Every literal gets a decoding scheme, variable names and
+// loop shapes picked at random, so that the decoders do not
+// share a common signature.
+type stringEncoder struct {
+	Rand *rand.Rand
+}
+
+// Code produces an expression which evaluates to str.
+func (e *stringEncoder) Code(str string) []byte {
+	if len(str) >= 2 && e.Rand.Intn(5) == 0 {
+		return []byte(e.split(str))
+	}
+	return []byte(e.scheme(str))
+}
+
+// split encodes parts of a string separately, and joins
+// them back together.
+func (e *stringEncoder) split(str string) string {
+	numParts := 2 + e.Rand.Intn(3)
+	if numParts > len(str) {
+		numParts = len(str)
+	}
+	cuts := e.Rand.Perm(len(str) - 1)[:numParts-1]
+	var parts []string
+	var last int
+	for i := 1; i < len(str); i++ {
+		for _, cut := range cuts {
+			if cut+1 == i {
+				parts = append(parts, e.scheme(str[last:i]))
+				last = i
+			}
+		}
+	}
+	parts = append(parts, e.scheme(str[last:]))
+	return "(" + strings.Join(parts, " + ") + ")"
+}
+
+func (e *stringEncoder) scheme(str string) string {
+	schemes := []func(string) string{e.xor, e.rolling, e.rotate, e.shuffle}
+	return schemes[e.Rand.Intn(len(schemes))](str)
+}
+
+// xor masks every byte with a random mask.
+func (e *stringEncoder) xor(str string) string {
+	names := e.names(4)
+	mask, data, idx, out := names[0], names[1], names[2], names[3]
+	maskBytes := e.randomBytes(len(str))
+	masked := make([]byte, len(str))
+	for i := range masked {
+		masked[i] = str[i] ^ maskBytes[i]
+	}
+
+	var res bytes.Buffer
+	res.WriteString("(func() string {\n")
+	decls := []string{
+		fmt.Sprintf("%s := %s\n", mask, e.bytesCode(maskBytes)),
+		fmt.Sprintf("%s := %s\n", data, e.bytesCode(masked)),
+	}
+	e.Rand.Shuffle(len(decls), func(i, j int) { decls[i], decls[j] = decls[j], decls[i] })
+	res.WriteString(strings.Join(decls, ""))
+	operands := []string{mask + "[" + idx + "]", data + "[" + idx + "]"}
+	e.Rand.Shuffle(2, func(i, j int) { operands[i], operands[j] = operands[j], operands[i] })
+	if e.Rand.Intn(2) == 0 {
+		fmt.Fprintf(&res, "%s := make([]byte, %s)\n", out, e.intCode(len(str)))
+		res.WriteString(e.loop(idx, out, false))
+		fmt.Fprintf(&res, "%s[%s] = %s ^ %s\n}\n", out, idx, operands[0], operands[1])
+		fmt.Fprintf(&res, "return string(%s)\n}())", out)
+	} else {
+		res.WriteString(e.loop(idx, data, false))
+		fmt.Fprintf(&res, "%s[%s] ^= %s[%s]\n}\n", data, idx, mask, idx)
+		fmt.Fprintf(&res, "return string(%s)\n}())", data)
+	}
+	return res.String()
+}
+
+// rolling adds or subtracts a key which changes after every
+// byte.
+func (e *stringEncoder) rolling(str string) string {
+	names := e.names(3)
+	data, key, idx := names[0], names[1], names[2]
+	start := byte(e.Rand.Intn(256))
+	step := byte(1 + e.Rand.Intn(255))
+	mul := byte(e.Rand.Intn(128)*2 + 1)
+	lcg := e.Rand.Intn(2) == 0
+	add := e.Rand.Intn(2) == 0
+
+	encoded := make([]byte, len(str))
+	k := start
+	for i := range encoded {
+		if add {
+			encoded[i] = str[i] + k
+		} else {
+			encoded[i] = str[i] - k
+		}
+		if lcg {
+			k = k*mul + step
+		} else {
+			k += step
+		}
+	}
+
+	var res bytes.Buffer
+	res.WriteString("(func() string {\n")
+	fmt.Fprintf(&res, "%s := %s\n", data, e.bytesCode(encoded))
+	fmt.Fprintf(&res, "%s := byte(%s)\n", key, e.intCode(int(start)))
+	res.WriteString(e.loop(idx, data, true))
+	op := "-="
+	if !add {
+		op = "+="
+	}
+	fmt.Fprintf(&res, "%s[%s] %s %s\n", data, idx, op, key)
+	if lcg {
+		fmt.Fprintf(&res, "%s = %s*%s + %s\n}\n", key, key, e.intCode(int(mul)), e.intCode(int(step)))
+	} else {
+		fmt.Fprintf(&res, "%s += %s\n}\n", key, e.intCode(int(step)))
+	}
+	fmt.Fprintf(&res, "return string(%s)\n}())", data)
+	return res.String()
+}
+
+// rotate rotates every byte by an amount which depends on
+// its index, after masking it with a constant byte.
+func (e *stringEncoder) rotate(str string) string {
+	names := e.names(3)
+	data, shift, idx := names[0], names[1], names[2]
+	base := e.Rand.Intn(8)
+	step := 1 + e.Rand.Intn(7)
+	mask := byte(e.Rand.Intn(256))
+
+	encoded := make([]byte, len(str))
+	for i := range encoded {
+		s := uint(base+i*step) % 8
+		b := str[i] ^ mask
+		encoded[i] = b<<s | b>>(8-s)
+	}
+
+	var res bytes.Buffer
+	res.WriteString("(func() string {\n")
+	fmt.Fprintf(&res, "%s := %s\n", data, e.bytesCode(encoded))
+	res.WriteString(e.loop(idx, data, false))
+	fmt.Fprintf(&res, "%s := uint(%s+%s*%s) %% 8\n", shift, e.intCode(base), idx, e.intCode(step))
+	fmt.Fprintf(&res, "%s[%s] = (%s[%s]>>%s | %s[%s]<<(8-%s)) ^ %s\n}\n", data, idx, data, idx, shift,
+		data, idx, shift, e.intCode(int(mask)))
+	fmt.Fprintf(&res, "return string(%s)\n}())", data)
+	return res.String()
+}
+
+// shuffle permutes the bytes, after masking them with a
+// constant byte.
+func (e *stringEncoder) shuffle(str string) string {
+	names := e.names(4)
+	data, perm, out, idx := names[0], names[1], names[2], names[3]
+	mask := byte(e.Rand.Intn(256))
+	p := e.Rand.Perm(len(str))
+
+	shuffled := make([]byte, len(str))
+	permCode := make([]string, len(str))
+	for i, j := range p {
+		shuffled[i] = str[j] ^ mask
+		permCode[i] = e.intCode(j)
+	}
+
+	var res bytes.Buffer
+	res.WriteString("(func() string {\n")
+	decls := []string{
+		fmt.Sprintf("%s := %s\n", data, e.bytesCode(shuffled)),
+		fmt.Sprintf("%s := []int{%s}\n", perm, strings.Join(permCode, ", ")),
+	}
+	e.Rand.Shuffle(len(decls), func(i, j int) { decls[i], decls[j] = decls[j], decls[i] })
+	res.WriteString(strings.Join(decls, ""))
+	fmt.Fprintf(&res, "%s := make([]byte, len(%s))\n", out, data)
+	res.WriteString(e.loop(idx, data, false))
+	fmt.Fprintf(&res, "%s[%s[%s]] = %s[%s] ^ %s\n}\n", out, perm, idx, data, idx, e.intCode(int(mask)))
+	fmt.Fprintf(&res, "return string(%s)\n}())", out)
+	return res.String()
+}
+
+// loop produces the header of a loop over the indices of a
+// slice. If ordered is false, the loop may run backwards.
+func (e *stringEncoder) loop(idx, slice string, ordered bool) string {
+	shapes := 2
+	if !ordered {
+		shapes = 3
+	}
+	switch e.Rand.Intn(shapes) {
+	case 0:
+		return fmt.Sprintf("for %s := range %s {\n", idx, slice)
+	case 1:
+		return fmt.Sprintf("for %s := 0; %s < len(%s); %s++ {\n", idx, idx, slice, idx)
+	default:
+		return fmt.Sprintf("for %s := len(%s) - 1; %s >= 0; %s-- {\n", idx, slice, idx, idx)
+	}
+}
+
+// bytesCode produces a []byte expression, either from a
+// string or from a composite literal.
+func (e *stringEncoder) bytesCode(data []byte) string {
+	if e.Rand.Intn(2) == 0 {
+		return "[]byte(\"" + hexEscape(data) + "\")"
+	}
+	parts := make([]string, len(data))
+	for i, b := range data {
+		parts[i] = e.intCode(int(b))
+	}
+	return "[]byte{" + strings.Join(parts, ", ") + "}"
+}
+
+// intCode formats an integer in decimal or hexadecimal.
+func (e *stringEncoder) intCode(x int) string {
+	if e.Rand.Intn(2) == 0 {
+		return fmt.Sprintf("0x%x", x)
+	}
+	return fmt.Sprint(x)
+}
+
+func (e *stringEncoder) randomBytes(n int) []byte {
+	res := make([]byte, n)
+	for i := range res {
+		res[i] = byte(e.Rand.Intn(256))
+	}
+	return res
+}
+
+// names produces distinct random identifiers which do not
+// shadow any keyword or predeclared name.
+func (e *stringEncoder) names(count int) []string {
+	var res []string
+	used := map[string]bool{}
+	for len(res) < count {
+		name := make([]byte, 1+e.Rand.Intn(6))
+		for i := range name {
+			name[i] = identLetters[e.Rand.Intn(len(identLetters))]
+		}
+		s := string(name)
+		if token.Lookup(s).IsKeyword() || types.Universe.Lookup(s) != nil || used[s] {
+			continue
+		}
+		used[s] = true
+		res = append(res, s)
+	}
+	return res
+}
+
+const identLetters = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"
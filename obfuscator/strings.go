@@ -0,0 +1,388 @@
+package obfuscator
+
+import (
+	crand "crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// A StringCipher determines how ObfuscateStrings encrypts
+// string literals.
+type StringCipher int
+
+const (
+	// StringXOR replaces every literal with a closure which
+	// decodes it. Every closure uses its own scheme, picked
+	// at random from XOR masks, rolling keys, rotations and
+	// permutations, and long literals may be split into
+	// parts with different schemes.
+	StringXOR StringCipher = iota
+
+	// StringAES encrypts every literal with AES-CTR, using a
+	// key which is derived from the padding for every
+	// package. The key is split between generated variables
+	// in a separate file of the package, and is only
+	// computed at runtime.
+	StringAES
+
+	// StringTable gathers the strings of every package into
+	// one blob, which is encrypted like StringAES. Every
+	// literal becomes a call to an accessor, which decrypts
+	// its entry the first time and caches it afterwards.
+	StringTable
+)
+
+// ParseStringCipher parses the name of a cipher, which is
+// "xor", "aes" or "table".
+func ParseStringCipher(name string) (StringCipher, error) {
+	switch name {
+	case "xor":
+		return StringXOR, nil
+	case "aes":
+		return StringAES, nil
+	case "table":
+		return StringTable, nil
+	}
+	return 0, fmt.Errorf("unknown string cipher: %q", name)
+}
+
+// StringOptions configures ObfuscateStrings.
+type StringOptions struct {
+	Cipher StringCipher
+
+	// Padding is used to derive the keys of StringAES and
+	// StringTable, along
+	// with the names of generated code.
+	// If it is empty, a random padding is used.
+	Padding NameHasher
+
+	// Policy, if non-nil, restricts the packages and strings
+	// which are encrypted.
+	// After packages have been moved, the policy must be
+	// updated with Policy.Moved.
+	Policy *Policy
+
+	// Configs are the build configurations that the code
+	// must build for, as for NewRenamer. Uses of constants
+	// are only encrypted if they are the same in all of
+	// them.
+	// If it is empty, the default configuration is used.
+	Configs []BuildConfig
+
+	// Rand makes every random choice, such as the decoders
+	// of StringXOR, the IVs and key shares of StringAES, and
+	// the padding if it is empty.
+	// If it is nil, the choices are random.
+	Rand *rand.Rand
+}
+
+// ObfuscateStrings encrypts the string literals in the Go
+// files of a GOPATH.
+//
+// Uses of string constants are encrypted as well, unless
+// they must be constant, such as in other constants, array
+// lengths or switch cases. This requires type-checking the
+// GOPATH, but constant declarations are left as they are,
+// so the code still compiles.
+//
+// Packages excluded by the policy or marked with
+// //gobfuscate:ignore, and files and functions marked with
+// //gobfuscate:nostrings, are left alone. Since this is the
+// last pass to change the source, it removes every
+// gobfuscate directive afterwards.
+//
+// If opts is nil, the default options are used.
+func ObfuscateStrings(gopath string, opts *StringOptions) error {
+	if opts == nil {
+		opts = &StringOptions{}
+	}
+	var all []string
+	dirs := map[string][]string{}
+	err := walkStringFiles(gopath, opts.Policy, func(path, skipReason string) error {
+		all = append(all, path)
+		if skipReason == "" {
+			dir := filepath.Dir(path)
+			dirs[dir] = append(dirs[dir], path)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	var uses map[string][]*constUse
+	if len(dirs) > 0 {
+		uses, err = findConstUses(gopath, opts.Configs)
+		if err != nil {
+			return fmt.Errorf("type-check constants: %s", err)
+		}
+	}
+
+	n := opts.Padding
+	if len(n) == 0 {
+		n = make(NameHasher, 32)
+		if opts.Rand != nil {
+			opts.Rand.Read(n)
+		} else {
+			crand.Read(n)
+		}
+	}
+	r := opts.Rand
+	if r == nil {
+		var seed [8]byte
+		crand.Read(seed[:])
+		r = rand.New(rand.NewSource(int64(binary.LittleEndian.Uint64(seed[:]))))
+	}
+	encoder := &stringEncoder{Rand: r}
+
+	srcDir := filepath.Join(gopath, "src")
+	for _, path := range all {
+		files, ok := dirs[filepath.Dir(path)]
+		if !ok {
+			continue
+		}
+		delete(dirs, filepath.Dir(path))
+		switch opts.Cipher {
+		case StringXOR:
+			for _, file := range files {
+				if _, err := obfuscateFileStrings(file, opts.Policy, encoder.Code, uses[file]); err != nil {
+					return err
+				}
+			}
+		case StringAES, StringTable:
+			table := opts.Cipher == StringTable
+			err := encryptDirStrings(srcDir, files, n, opts.Policy, table, encoder, uses)
+			if err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("unknown string cipher: %d", opts.Cipher)
+		}
+	}
+
+	for _, path := range all {
+		if err := stripDirectives(path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// walkStringFiles calls fn for every Go file in a GOPATH,
+// along with the reason why the strings of its package are
+// not encrypted according to the policy and to
+// //gobfuscate:ignore directives, or "" if they are.
+func walkStringFiles(gopath string, policy *Policy, fn func(path, skipReason string) error) error {
+	if err := policy.compile(); err != nil {
+		return err
+	}
+	srcDir := filepath.Join(gopath, "src")
+	ignoredDirs := map[string]bool{}
+	return filepath.Walk(gopath, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || !isGoFile(path) {
+			return nil
+		}
+		dir := filepath.Dir(path)
+		ignored, ok := ignoredDirs[dir]
+		if !ok {
+			ignored, err = dirHasDirective(dir, ignoreDirective)
+			if err != nil {
+				return err
+			}
+			ignoredDirs[dir] = ignored
+		}
+		if ignored {
+			return fn(path, "its package is marked with "+ignoreDirective)
+		}
+		if rel, err := filepath.Rel(srcDir, dir); err == nil && !policy.encrypts(filepath.ToSlash(rel)) {
+			return fn(path, "its package is excluded by the policy")
+		}
+		return fn(path, "")
+	})
+}
+
+// obfuscateFileStrings replaces the string literals in a
+// file, and the uses of constants found by findConstUses,
+// with the code produced by encode, and reports the number
+// of replacements.
+func obfuscateFileStrings(path string, policy *Policy, encode func(str string) []byte,
+	uses []*constUse) (int, error) {
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+
+	set := token.NewFileSet()
+	file, err := parser.ParseFile(set, path, contents, parser.ParseComments)
+	if err != nil || fileHasDirective(file, noStringsDirective) {
+		return 0, nil
+	}
+
+	obfuscator := &stringObfuscator{Contents: contents, Policy: policy, Encode: encode, Uses: uses}
+	for _, decl := range file.Decls {
+		ast.Walk(obfuscator, decl)
+	}
+	newCode, count, err := obfuscator.Obfuscate()
+	if err != nil || count == 0 {
+		return 0, err
+	}
+	return count, ioutil.WriteFile(path, newCode, 0755)
+}
+
+type stringObfuscator struct {
+	Contents []byte
+	Nodes    []*ast.BasicLit
+	Policy   *Policy
+	Encode   func(str string) []byte
+
+	// Uses are the uses of constants which are replaced
+	// along with the literals.
+	Uses []*constUse
+
+	// Skipped are the literals which are left alone
+	// wherever they appear, keyed by the reason.
+	Skipped map[*ast.BasicLit]string
+}
+
+func (s *stringObfuscator) Visit(n ast.Node) ast.Visitor {
+	if lit, ok := n.(*ast.BasicLit); ok {
+		if lit.Kind == token.STRING {
+			s.Nodes = append(s.Nodes, lit)
+		}
+		return nil
+	} else if decl, ok := n.(*ast.GenDecl); ok {
+		if decl.Tok == token.IMPORT {
+			return nil
+		} else if decl.Tok == token.CONST {
+			s.skip(n, "constant declarations cannot be encrypted")
+			return nil
+		}
+	} else if _, ok := n.(*ast.StructType); ok {
+		// Avoid messing with annotation strings, including
+		// the tags added by Renamer.InjectTags.
+		s.skip(n, "struct tags are kept")
+		return nil
+	} else if fn, ok := n.(*ast.FuncDecl); ok && hasDirective(fn.Doc, noStringsDirective) {
+		s.skip(n, "its function is marked with "+noStringsDirective)
+		return nil
+	}
+	return s
+}
+
+func (s *stringObfuscator) skip(n ast.Node, reason string) {
+	for _, lit := range stringLiterals(n) {
+		if s.Skipped == nil {
+			s.Skipped = map[*ast.BasicLit]string{}
+		}
+		s.Skipped[lit] = reason
+	}
+}
+
+// stringLiterals finds the string literals in a node,
+// except for import paths.
+func stringLiterals(n ast.Node) []*ast.BasicLit {
+	var res []*ast.BasicLit
+	ast.Inspect(n, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.ImportSpec:
+			return false
+		case *ast.BasicLit:
+			if n.Kind == token.STRING {
+				res = append(res, n)
+			}
+		}
+		return true
+	})
+	return res
+}
+
+// Literals finds the literals which are replaced one by
+// one, leaving out those inside of uses of constants and
+// those excluded by the policy.
+func (s *stringObfuscator) Literals() ([]*ast.BasicLit, []string, error) {
+	var nodes []*ast.BasicLit
+	var values []string
+	for _, node := range s.Nodes {
+		value, err := strconv.Unquote(node.Value)
+		if err != nil {
+			return nil, nil, err
+		}
+		if s.Policy.excludesString(value) || s.inUse(node) {
+			continue
+		}
+		nodes = append(nodes, node)
+		values = append(values, value)
+	}
+	return nodes, values, nil
+}
+
+// skipReason finds why a literal is left alone, or returns
+// "" if it is replaced, either on its own or along with a
+// use of constants.
+func (s *stringObfuscator) skipReason(node *ast.BasicLit, value string) string {
+	const policyReason = "excluded by the policy"
+	for _, use := range s.Uses {
+		if int(node.Pos()-1) >= use.Start && int(node.End()-1) <= use.End {
+			if use.Keep {
+				return "must stay constant"
+			} else if s.Policy.excludesString(use.Value) {
+				return policyReason
+			}
+			return ""
+		}
+	}
+	if s.Policy.excludesString(value) {
+		return policyReason
+	}
+	return ""
+}
+
+func (s *stringObfuscator) inUse(node ast.Node) bool {
+	for _, use := range s.Uses {
+		if int(node.Pos()-1) >= use.Start && int(node.End()-1) <= use.End {
+			return true
+		}
+	}
+	return false
+}
+
+// Obfuscate replaces the literals and the uses of constants
+// with the code produced by s.Encode, and reports the
+// number of replacements.
+func (s *stringObfuscator) Obfuscate() ([]byte, int, error) {
+	nodes, values, err := s.Literals()
+	if err != nil {
+		return nil, 0, err
+	}
+	var edits []edit
+	for _, use := range s.Uses {
+		if !use.Keep && !s.Policy.excludesString(use.Value) {
+			edits = append(edits, edit{
+				Start: use.Start,
+				End:   use.End,
+				Text:  string(use.Code(s.Encode(use.Value))),
+			})
+		}
+	}
+	for i, node := range nodes {
+		edits = append(edits, edit{
+			Start: int(node.Pos() - 1),
+			End:   int(node.End() - 1),
+			Text:  string(s.Encode(values[i])),
+		})
+	}
+	if len(edits) == 0 {
+		return s.Contents, 0, nil
+	}
+	return applyEdits(s.Contents, edits), len(edits), nil
+}
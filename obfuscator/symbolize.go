@@ -0,0 +1,94 @@
+package obfuscator
+
+import (
+	"bufio"
+	"io"
+	"regexp"
+	"strings"
+)
+
+var symbolizeTokenExpr = regexp.MustCompile(`[A-Za-z0-9_]+`)
+
+// symbolizePathExpr also matches hashed first components of
+// import paths, which end with hashedDomainSuffix.
+var symbolizePathExpr = regexp.MustCompile(`[A-Za-z0-9_]+(` + regexp.QuoteMeta(hashedDomainSuffix) + `)?`)
+
+// A Symbolizer rewrites obfuscated names in text, such as
+// stack traces and logs, back to their original names.
+//
+// Every hashed path component and identifier is replaced
+// on its own, so names are restored in any context where
+// they appear, including file paths, method expressions
+// like "(*T).Method" and closures like "Func.func1".
+type Symbolizer struct {
+	names map[string]string
+}
+
+// NewSymbolizer creates a Symbolizer for a mapping.
+func NewSymbolizer(m *Mapping) *Symbolizer {
+	s := &Symbolizer{names: map[string]string{}}
+	for _, entry := range m.Entries {
+		if entry.Kind == KindPackage {
+			s.addNames(strings.Split(entry.Original, "/"), strings.Split(entry.Obfuscated, "/"))
+			continue
+		}
+		// The last identifiers of a qualified name are the
+		// symbol name, preceded by the receiver for methods
+		// and by the struct type for fields.
+		count := 1
+		if entry.Kind == KindMethod || entry.Kind == KindField {
+			count = 2
+		}
+		original := symbolizeTokenExpr.FindAllString(entry.Original, -1)
+		obfuscated := symbolizeTokenExpr.FindAllString(entry.Obfuscated, -1)
+		if len(original) >= count && len(obfuscated) >= count {
+			s.addNames(original[len(original)-count:], obfuscated[len(obfuscated)-count:])
+		}
+	}
+	return s
+}
+
+func (s *Symbolizer) addNames(original, obfuscated []string) {
+	if len(original) != len(obfuscated) {
+		return
+	}
+	for i, name := range obfuscated {
+		if name != original[i] {
+			s.names[name] = original[i]
+		}
+	}
+}
+
+// Symbolize replaces every obfuscated name in a string.
+func (s *Symbolizer) Symbolize(text string) string {
+	return symbolizePathExpr.ReplaceAllStringFunc(text, func(token string) string {
+		if name, ok := s.names[token]; ok {
+			return name
+		}
+		if trimmed := strings.TrimSuffix(token, hashedDomainSuffix); trimmed != token {
+			if name, ok := s.names[trimmed]; ok {
+				return name + hashedDomainSuffix
+			}
+		}
+		return token
+	})
+}
+
+// SymbolizeStream symbolizes text line by line, so that
+// the output of a running program can be piped through it.
+func (s *Symbolizer) SymbolizeStream(r io.Reader, w io.Writer) error {
+	reader := bufio.NewReader(r)
+	for {
+		line, err := reader.ReadString('\n')
+		if line != "" {
+			if _, err := io.WriteString(w, s.Symbolize(line)); err != nil {
+				return err
+			}
+		}
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package obfuscator
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestSymbolize(t *testing.T) {
+	s := NewSymbolizer(&Mapping{
+		Entries: []*MappingEntry{
+			{Kind: KindPackage, Original: "example.com/app/util", Obfuscated: "aaaa.invalid/bbbb/cccc"},
+			{Kind: KindFunc, Original: "example.com/app/util.Parse", Obfuscated: "aaaa.invalid/bbbb/cccc.dddd"},
+			{Kind: KindType, Original: "example.com/app/util.Reader", Obfuscated: "aaaa.invalid/bbbb/cccc.eeee"},
+			{
+				Kind:       KindMethod,
+				Original:   "example.com/app/util.(*Reader).Next",
+				Obfuscated: "aaaa.invalid/bbbb/cccc.(*eeee).ffff",
+			},
+			{
+				Kind:       KindField,
+				Original:   "example.com/app/util.Reader.buf",
+				Obfuscated: "aaaa.invalid/bbbb/cccc.eeee.gggg",
+			},
+		},
+	})
+	tests := []struct {
+		in  string
+		out string
+	}{
+		{"", ""},
+		{"nothing to see", "nothing to see"},
+		{"aaaa.invalid/bbbb/cccc.dddd(...)", "example.com/app/util.Parse(...)"},
+		{"aaaa.invalid/bbbb/cccc.(*eeee).ffff(0xc000010000)", "example.com/app/util.(*Reader).Next(0xc000010000)"},
+		{"aaaa.invalid/bbbb/cccc.dddd.func1()", "example.com/app/util.Parse.func1()"},
+		{"\t/tmp/src/aaaa.invalid/bbbb/cccc/file.go:12 +0x1d", "\t/tmp/src/example.com/app/util/file.go:12 +0x1d"},
+		{"{gggg:3}", "{buf:3}"},
+		{"ddddx xdddd dddd_2", "ddddx xdddd dddd_2"},
+	}
+	for _, test := range tests {
+		if actual := s.Symbolize(test.in); actual != test.out {
+			t.Errorf("Symbolize(%q) = %q, expected %q", test.in, actual, test.out)
+		}
+	}
+}
+
+func TestSymbolizeStream(t *testing.T) {
+	s := NewSymbolizer(&Mapping{
+		Entries: []*MappingEntry{
+			{Kind: KindFunc, Original: "main.run", Obfuscated: "main.hhhh"},
+		},
+	})
+	in := "goroutine 1 [running]:\nmain.hhhh()\nno newline: hhhh"
+	var out bytes.Buffer
+	if err := s.SymbolizeStream(strings.NewReader(in), &out); err != nil {
+		t.Fatal(err)
+	}
+	expected := "goroutine 1 [running]:\nmain.run()\nno newline: run"
+	if out.String() != expected {
+		t.Errorf("got %q, expected %q", out.String(), expected)
+	}
+}
@@ -0,0 +1,300 @@
+package obfuscator
+
+import (
+	"fmt"
+	"go/ast"
+	"go/types"
+	"strings"
+)
+
+var IgnoreMethods = map[string]bool{"main": true, "init": true}
+
+type symbolRenameReq struct {
+	Object  types.Object
+	NewName string
+}
+
+// ObfuscateSymbols renames the symbols of every package in
+// a GOPATH, except for those excluded by the policy (if it
+// is non-nil).
+func ObfuscateSymbols(gopath string, n NameHasher, policy *Policy) error {
+	r, err := NewRenamer(gopath, n)
+	if err != nil {
+		return err
+	}
+	r.Policy = policy
+	if err := r.RenameSymbols(); err != nil {
+		return err
+	}
+	return r.Apply()
+}
+
+// RenameSymbols adds renames for top-level declarations,
+// methods and struct fields throughout the workspace and
+// its variants.
+func (r *Renamer) RenameSymbols() error {
+	if err := r.Policy.compile(); err != nil {
+		return err
+	}
+	renames := map[types.Object]string{}
+	for _, w := range r.workspaces() {
+		topLevel, err := r.topLevelRenames(w)
+		if err != nil {
+			return fmt.Errorf("top-level renames: %s", err)
+		}
+		fields, err := r.fieldRenames(w)
+		if err != nil {
+			return fmt.Errorf("field renames: %s", err)
+		}
+		for _, req := range append(topLevel, fields...) {
+			if name, ok := r.importedName(req.Object); ok {
+				req.NewName = name
+			}
+			renames[req.Object] = req.NewName
+		}
+	}
+
+	// Methods are renamed in groups, which take care of
+	// imported names themselves.
+	methods, err := r.methodRenames()
+	if err != nil {
+		return fmt.Errorf("method renames: %s", err)
+	}
+	for _, req := range methods {
+		renames[req.Object] = req.NewName
+	}
+	r.reconcile(renames)
+	r.rewriteLinknames()
+	return nil
+}
+
+func (r *Renamer) topLevelRenames(w *Workspace) ([]symbolRenameReq, error) {
+	res := map[symbolRenameReq]int{}
+	reflected := reflectedTypes(w)
+	for _, pkg := range w.SortedPackages() {
+		ignored, err := r.ignoredDecls(pkg)
+		if err != nil {
+			return nil, err
+		}
+		addRes := func(name *ast.Ident) {
+			obj := pkg.Info.Defs[name]
+			if obj == nil || name.Name == "_" {
+				return
+			}
+			reason, ok := ignored[name.Name]
+			if !ok {
+				reason = r.policyReason(obj)
+			}
+			if typeName, ok := obj.(*types.TypeName); ok && reason == "" {
+				reason = xmlTypeReason(typeName, reflected[typeName])
+			}
+			if reason != "" {
+				r.Skipped = append(r.Skipped, &Skip{
+					Kind:     objectKind(obj),
+					Name:     r.qualifiedName(obj, false),
+					Position: r.objectPosition(obj),
+					Reason:   reason,
+				})
+				return
+			}
+			res[symbolRenameReq{obj, hashObject(r.Hasher, obj)}]++
+		}
+		for _, file := range pkg.Files {
+			if pkg.TestFiles[file] {
+				continue
+			}
+			for _, decl := range file.Decls {
+				switch d := decl.(type) {
+				case *ast.FuncDecl:
+					if !IgnoreMethods[d.Name.Name] && d.Recv == nil {
+						addRes(d.Name)
+					}
+				case *ast.GenDecl:
+					for _, spec := range d.Specs {
+						switch spec := spec.(type) {
+						case *ast.TypeSpec:
+							addRes(spec.Name)
+						case *ast.ValueSpec:
+							for _, name := range spec.Names {
+								addRes(name)
+							}
+						}
+					}
+				}
+			}
+		}
+	}
+	return r.singleRenames(res), nil
+}
+
+// hashObject hashes the name of an object in the domain of
+// its package and kind.
+func hashObject(n NameHasher, obj types.Object) string {
+	return n.Hash(obj.Pkg().Path(), objectKind(obj), obj.Name())
+}
+
+func objectKind(obj types.Object) NameKind {
+	switch obj := obj.(type) {
+	case *types.TypeName:
+		return KindType
+	case *types.Func:
+		if obj.Type().(*types.Signature).Recv() != nil {
+			return KindMethod
+		}
+		return KindFunc
+	case *types.Const:
+		return KindConst
+	case *types.Var:
+		if obj.IsField() {
+			return KindField
+		}
+	}
+	return KindVar
+}
+
+// ignoredDecls finds the names of top-level declarations
+// and methods in the files of a package which cannot be
+// renamed, along with the reasons.
+//
+// These are the declarations in files which are excluded
+// by build constraints (and not type-checked in any other
+// workspace), the declarations which assembly refers to
+// through go_asm.h, the declarations which C code may refer
+// to, the declarations which //go:linkname directives
+// refer to in ways that cannot be rewritten, and the
+// declarations marked with //gobfuscate:keep.
+//
+// Methods are listed as "Receiver.Method".
+func (r *Renamer) ignoredDecls(pkg *WorkspacePackage) (map[string]string, error) {
+	if pkg.XTest {
+		return map[string]string{}, nil
+	}
+	res, err := asmIgnoredDecls(pkg)
+	if err != nil {
+		return nil, err
+	}
+	add := func(name, reason string) {
+		if _, ok := res[name]; !ok {
+			res[name] = reason
+		}
+	}
+	for name, reason := range cgoIgnoredDecls(pkg) {
+		add(name, reason)
+	}
+	linknames, err := r.linknameIgnoredDecls()
+	if err != nil {
+		return nil, err
+	}
+	for name, reason := range linknames[pkg.Build.ImportPath] {
+		add(name, reason)
+	}
+	for _, file := range pkg.Files {
+		for _, name := range keepDirectiveDecls(file) {
+			add(name, "marked with "+keepDirective)
+		}
+	}
+
+	excludedDecls, _, err := r.excludedUses()
+	if err != nil {
+		return nil, err
+	}
+	for name, reason := range excludedDecls[pkg.Build.ImportPath] {
+		add(name, reason)
+	}
+
+	const excluded = "also declared in a file excluded by build constraints"
+	files, err := r.excludedFiles(pkg)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range files {
+		if strings.HasSuffix(f.Path, "_test.go") {
+			continue
+		}
+		for _, decl := range f.File.Decls {
+			switch d := decl.(type) {
+			case *ast.FuncDecl:
+				if d.Recv == nil {
+					add(d.Name.Name, excluded)
+					continue
+				}
+				for _, rec := range d.Recv.List {
+					if receiver := receiverString(rec); receiver != "" {
+						add(receiver+"."+d.Name.Name, excluded)
+					}
+				}
+			case *ast.GenDecl:
+				for _, spec := range d.Specs {
+					switch spec := spec.(type) {
+					case *ast.TypeSpec:
+						add(spec.Name.Name, excluded)
+					case *ast.ValueSpec:
+						for _, name := range spec.Names {
+							add(name.Name, excluded)
+						}
+					}
+				}
+			}
+		}
+	}
+	return res, nil
+}
+
+// policyReason finds the reason that r.Policy or a
+// //gobfuscate:ignore directive excludes a declaration from
+// renaming, or returns "".
+func (r *Renamer) policyReason(obj types.Object) string {
+	if !r.Policy.renames(obj.Pkg().Path()) {
+		return "its package is excluded by the policy"
+	} else if r.ignoresPackage(obj.Pkg().Path()) {
+		return "its package is marked with " + ignoreDirective
+	} else if r.Policy.keeps(obj.Name(), r.qualifiedName(obj, false)) {
+		return "kept by the policy"
+	}
+	return ""
+}
+
+// singleRenames removes any rename requests which appear
+// more than one time, and records them as skipped.
+func (r *Renamer) singleRenames(multiset map[symbolRenameReq]int) []symbolRenameReq {
+	var res []symbolRenameReq
+	for x, count := range multiset {
+		if count == 1 {
+			res = append(res, x)
+			continue
+		}
+		r.Skipped = append(r.Skipped, &Skip{
+			Kind:     objectKind(x.Object),
+			Name:     r.qualifiedName(x.Object, false),
+			Position: r.objectPosition(x.Object),
+			Reason:   "declared more than once",
+		})
+	}
+	return res
+}
+
+// receiverString gets the string representation of a
+// method receiver, such as "T" or "(*T)".
+// Type parameters of generic receivers are omitted, so
+// that "(*List[T])" becomes "(*List)".
+func receiverString(rec *ast.Field) string {
+	recType := rec.Type
+	star, isStar := recType.(*ast.StarExpr)
+	if isStar {
+		recType = star.X
+	}
+	switch generic := recType.(type) {
+	case *ast.IndexExpr:
+		recType = generic.X
+	case *ast.IndexListExpr:
+		recType = generic.X
+	}
+	ident, ok := recType.(*ast.Ident)
+	if !ok {
+		return ""
+	}
+	if isStar {
+		return "(*" + ident.Name + ")"
+	}
+	return ident.Name
+}
@@ -0,0 +1,156 @@
+package obfuscator
+
+import (
+	"errors"
+	"go/types"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// TagEncoders maps reflection sinks which read field names
+// from struct tags to the tag keys that they read.
+//
+// Struct fields which only reach these sinks can be renamed
+// if Renamer.InjectTags is set, since the original names
+// are then kept in their tags.
+var TagEncoders = map[string]string{
+	"encoding/json":    "json",
+	"encoding/xml":     "xml",
+	"log/slog":         "json",
+	"gopkg.in/yaml.v2": "yaml",
+	"gopkg.in/yaml.v3": "yaml",
+	"sigs.k8s.io/yaml": "json",
+}
+
+// A tagPair is a key and value from a struct tag.
+type tagPair struct {
+	Key   string
+	Value string
+}
+
+// parseTag splits a conventional struct tag, as accepted
+// by reflect.StructTag, into key-value pairs.
+func parseTag(tag string) ([]tagPair, error) {
+	var res []tagPair
+	for {
+		tag = strings.TrimLeft(tag, " ")
+		if tag == "" {
+			return res, nil
+		}
+		colon := strings.Index(tag, ":")
+		if colon <= 0 || colon+1 >= len(tag) || tag[colon+1] != '"' ||
+			strings.ContainsAny(tag[:colon], " \"") {
+			return nil, errors.New("malformed struct tag")
+		}
+		key := tag[:colon]
+		tag = tag[colon+1:]
+		end := 1
+		for end < len(tag) && tag[end] != '"' {
+			if tag[end] == '\\' {
+				end++
+			}
+			end++
+		}
+		if end >= len(tag) {
+			return nil, errors.New("malformed struct tag")
+		}
+		value, err := strconv.Unquote(tag[:end+1])
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, tagPair{Key: key, Value: value})
+		tag = tag[end+1:]
+	}
+}
+
+func formatTag(pairs []tagPair) string {
+	parts := make([]string, len(pairs))
+	for i, pair := range pairs {
+		parts[i] = pair.Key + ":" + strconv.Quote(pair.Value)
+	}
+	return strings.Join(parts, " ")
+}
+
+// nameTag makes sure that a struct tag gives a field name
+// explicitly for every one of the given keys.
+func nameTag(tag, fieldName string, keys []string) (string, error) {
+	pairs, err := parseTag(tag)
+	if err != nil {
+		return "", err
+	}
+	for _, key := range keys {
+		found := false
+		for i, pair := range pairs {
+			if pair.Key != key {
+				continue
+			}
+			found = true
+			parts := strings.Split(pair.Value, ",")
+			if parts[0] == "" && !tagIgnoresName(key, parts[1:]) {
+				parts[0] = defaultTagName(key, fieldName)
+				pairs[i].Value = strings.Join(parts, ",")
+			}
+		}
+		if !found {
+			pairs = append(pairs, tagPair{Key: key, Value: defaultTagName(key, fieldName)})
+		}
+	}
+	return formatTag(pairs), nil
+}
+
+// defaultTagName finds the name that the encoders for a tag
+// key use for a field without a tag.
+//
+// The YAML packages lowercase field names, while the other
+// encoders use them as they are.
+func defaultTagName(key, fieldName string) string {
+	if key == "yaml" {
+		return strings.ToLower(fieldName)
+	}
+	return fieldName
+}
+
+// xmlTypeReason finds the reason that encoding/xml keeps a
+// type from being renamed, or returns "".
+//
+// The XML element for a value is named after its type,
+// unless it is a struct with an XMLName field that gives a
+// name in its tag.
+func xmlTypeReason(obj *types.TypeName, reflected *reflectedType) string {
+	if reflected == nil || !reflected.Sinks["encoding/xml"] {
+		return ""
+	}
+	if st, ok := obj.Type().Underlying().(*types.Struct); ok {
+		for i := 0; i < st.NumFields(); i++ {
+			if st.Field(i).Name() != "XMLName" {
+				continue
+			}
+			tag, _ := reflect.StructTag(st.Tag(i)).Lookup("xml")
+			if strings.Split(tag, ",")[0] != "" {
+				return ""
+			}
+		}
+	}
+	return "may name an XML element, since encoding/xml may reach it"
+}
+
+// tagIgnoresName checks if the options of a tag make an
+// encoder ignore the name of a field.
+func tagIgnoresName(key string, options []string) bool {
+	for _, option := range options {
+		switch key + "," + option {
+		case "xml,chardata", "xml,innerxml", "xml,comment", "xml,any", "yaml,inline":
+			return true
+		}
+	}
+	return false
+}
+
+// quoteTag creates a literal for a struct tag.
+func quoteTag(tag string) string {
+	if strings.Contains(tag, "`") {
+		return strconv.Quote(tag)
+	}
+	return "`" + tag + "`"
+}
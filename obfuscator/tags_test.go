@@ -0,0 +1,118 @@
+package obfuscator
+
+import (
+	"go/token"
+	"go/types"
+	"reflect"
+	"testing"
+)
+
+func TestParseTag(t *testing.T) {
+	tests := []struct {
+		tag   string
+		pairs []tagPair
+		err   bool
+	}{
+		{tag: "", pairs: nil},
+		{tag: `json:"name"`, pairs: []tagPair{{"json", "name"}}},
+		{
+			tag:   `json:"name,omitempty" xml:"n"`,
+			pairs: []tagPair{{"json", "name,omitempty"}, {"xml", "n"}},
+		},
+		{tag: `  yaml:"-"  `, pairs: []tagPair{{"yaml", "-"}}},
+		{tag: `a:"quote \" inside"`, pairs: []tagPair{{"a", `quote " inside`}}},
+		{tag: `json:name`, err: true},
+		{tag: `json:"name`, err: true},
+		{tag: `:"name"`, err: true},
+		{tag: `bad key:"name"`, err: true},
+		{tag: `json:`, err: true},
+	}
+	for _, test := range tests {
+		pairs, err := parseTag(test.tag)
+		if test.err {
+			if err == nil {
+				t.Errorf("parseTag(%q): expected an error", test.tag)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseTag(%q): %s", test.tag, err)
+		} else if !reflect.DeepEqual(pairs, test.pairs) {
+			t.Errorf("parseTag(%q) = %v, expected %v", test.tag, pairs, test.pairs)
+		}
+	}
+}
+
+func TestNameTag(t *testing.T) {
+	tests := []struct {
+		tag      string
+		field    string
+		keys     []string
+		expected string
+	}{
+		{"", "Name", []string{"json"}, `json:"Name"`},
+		{"", "UserID", []string{"yaml"}, `yaml:"userid"`},
+		{"", "Name", []string{"json", "xml"}, `json:"Name" xml:"Name"`},
+		{`json:",omitempty"`, "Name", []string{"json"}, `json:"Name,omitempty"`},
+		{`yaml:",omitempty"`, "Name", []string{"yaml"}, `yaml:"name,omitempty"`},
+		{`json:"custom"`, "Name", []string{"json"}, `json:"custom"`},
+		{`json:"-"`, "Name", []string{"json"}, `json:"-"`},
+		{`xml:",chardata"`, "Text", []string{"xml"}, `xml:",chardata"`},
+		{`yaml:",inline"`, "Base", []string{"yaml"}, `yaml:",inline"`},
+		{`db:"name"`, "Name", []string{"json"}, `db:"name" json:"Name"`},
+	}
+	for _, test := range tests {
+		actual, err := nameTag(test.tag, test.field, test.keys)
+		if err != nil {
+			t.Errorf("nameTag(%q, %q): %s", test.tag, test.field, err)
+		} else if actual != test.expected {
+			t.Errorf("nameTag(%q, %q) = %q, expected %q", test.tag, test.field, actual,
+				test.expected)
+		}
+	}
+	if _, err := nameTag(`json:"x`, "Name", []string{"json"}); err == nil {
+		t.Error("expected an error for a malformed tag")
+	}
+}
+
+func TestXMLTypeReason(t *testing.T) {
+	pkg := types.NewPackage("example.com/p", "p")
+	xmlName := types.NewNamed(types.NewTypeName(token.NoPos, types.NewPackage("encoding/xml", "xml"),
+		"Name", nil), types.NewStruct(nil, nil), nil)
+	newType := func(hasXMLName bool, tag string) *types.TypeName {
+		var fields []*types.Var
+		var tags []string
+		if hasXMLName {
+			fields = append(fields, types.NewField(token.NoPos, pkg, "XMLName", xmlName, false))
+			tags = append(tags, tag)
+		}
+		fields = append(fields, types.NewField(token.NoPos, pkg, "Body", types.Typ[types.String], false))
+		tags = append(tags, "")
+		obj := types.NewTypeName(token.NoPos, pkg, "Msg", nil)
+		types.NewNamed(obj, types.NewStruct(fields, tags), nil)
+		return obj
+	}
+	xmlSink := &reflectedType{Sinks: map[string]bool{"encoding/xml": true}}
+	jsonSink := &reflectedType{Sinks: map[string]bool{"encoding/json": true}}
+
+	tests := []struct {
+		hasXMLName bool
+		tag        string
+		reflected  *reflectedType
+		kept       bool
+	}{
+		{false, "", nil, false},
+		{false, "", jsonSink, false},
+		{false, "", xmlSink, true},
+		{true, "", xmlSink, true},
+		{true, `xml:",omitempty"`, xmlSink, true},
+		{true, `xml:"msg"`, xmlSink, false},
+		{true, `xml:"urn:x msg"`, xmlSink, false},
+	}
+	for _, test := range tests {
+		reason := xmlTypeReason(newType(test.hasXMLName, test.tag), test.reflected)
+		if (reason != "") != test.kept {
+			t.Errorf("XMLName tag %q: got reason %q, expected kept=%v", test.tag, reason, test.kept)
+		}
+	}
+}
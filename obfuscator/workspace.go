@@ -0,0 +1,309 @@
+package obfuscator
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// A Workspace is a type-checked view of every package in
+// a GOPATH.
+type Workspace struct {
+	Gopath string
+	Fset   *token.FileSet
+
+	// Config is the build configuration that the packages
+	// were type-checked for.
+	Config BuildConfig
+
+	// Packages maps import paths to packages.
+	// External test packages are stored under their
+	// import path with a "_test" suffix.
+	Packages map[string]*WorkspacePackage
+
+	ctx      build.Context
+	std      types.Importer
+	stdDeps  []string
+	checking map[string]bool
+}
+
+// A WorkspacePackage is a type-checked package from a
+// Workspace.
+type WorkspacePackage struct {
+	Build *build.Package
+	Files []*ast.File
+
+	// TestFiles indicates which Files are _test.go files.
+	TestFiles map[*ast.File]bool
+
+	Types *types.Package
+	Info  *types.Info
+
+	// XTest is set for external test packages.
+	XTest bool
+}
+
+// LoadWorkspace parses and type-checks every package in a
+// GOPATH.
+// Packages outside of the GOPATH are imported from the
+// standard library's export data.
+//
+// Type errors do not stop the loading process, since
+// partial type information is still useful for renaming.
+func LoadWorkspace(gopath string) (*Workspace, error) {
+	return LoadWorkspaceConfig(gopath, BuildConfig{}, token.NewFileSet())
+}
+
+// LoadWorkspaceConfig is like LoadWorkspace, but it loads
+// the packages for a specific build configuration, and adds
+// their files to an existing FileSet.
+func LoadWorkspaceConfig(gopath string, config BuildConfig, fset *token.FileSet) (*Workspace, error) {
+	w := &Workspace{
+		Gopath:   gopath,
+		Fset:     fset,
+		Config:   config,
+		Packages: map[string]*WorkspacePackage{},
+		ctx:      gopathContext(gopath, config),
+		checking: map[string]bool{},
+	}
+
+	buildPkgs, err := w.buildPackages()
+	if err != nil {
+		return nil, err
+	}
+	w.std, w.stdDeps, err = stdImporter(w.Fset, w.externalImports(buildPkgs), config)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, pkg := range buildPkgs {
+		if _, err := w.check(pkg); err != nil {
+			return nil, err
+		}
+		if len(pkg.XTestGoFiles) > 0 {
+			if err := w.checkXTest(pkg); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return w, nil
+}
+
+// StdPackages imports every standard library package that
+// the workspace depends on, directly or indirectly.
+func (w *Workspace) StdPackages() []*types.Package {
+	var res []*types.Package
+	for _, path := range w.stdDeps {
+		if pkg, err := w.std.Import(path); err == nil {
+			res = append(res, pkg)
+		}
+	}
+	return res
+}
+
+// SortedPackages returns the packages in order of their
+// import paths.
+func (w *Workspace) SortedPackages() []*WorkspacePackage {
+	var paths []string
+	for path := range w.Packages {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	res := make([]*WorkspacePackage, len(paths))
+	for i, path := range paths {
+		res[i] = w.Packages[path]
+	}
+	return res
+}
+
+// Import implements types.Importer.
+func (w *Workspace) Import(path string) (*types.Package, error) {
+	return w.ImportFrom(path, "", 0)
+}
+
+// ImportFrom implements types.ImporterFrom.
+func (w *Workspace) ImportFrom(path, dir string, mode types.ImportMode) (*types.Package, error) {
+	if path == "unsafe" {
+		return types.Unsafe, nil
+	}
+	pkg, err := w.ctx.Import(path, dir, 0)
+	if err != nil {
+		if _, ok := err.(*build.NoGoError); !ok {
+			return nil, err
+		}
+	}
+	if pkg.Goroot {
+		return w.std.Import(pkg.ImportPath)
+	}
+	return w.check(pkg)
+}
+
+func (w *Workspace) buildPackages() ([]*build.Package, error) {
+	srcDir := filepath.Join(w.Gopath, "src")
+	var res []*build.Package
+	err := filepath.Walk(srcDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			return nil
+		}
+		pkg, err := w.ctx.ImportDir(path, 0)
+		if err != nil {
+			if _, ok := err.(*build.NoGoError); ok {
+				return nil
+			}
+			return fmt.Errorf("import %s: %s", path, err)
+		}
+		res = append(res, pkg)
+		return nil
+	})
+	return res, err
+}
+
+func (w *Workspace) externalImports(pkgs []*build.Package) []string {
+	seen := map[string]bool{}
+	var res []string
+	for _, pkg := range pkgs {
+		for _, imports := range [][]string{pkg.Imports, pkg.TestImports, pkg.XTestImports} {
+			for _, path := range imports {
+				if path == "C" || path == "unsafe" || seen[path] {
+					continue
+				}
+				seen[path] = true
+				imported, err := w.ctx.Import(path, pkg.Dir, build.FindOnly)
+				if err == nil && imported.Goroot {
+					res = append(res, path)
+				}
+			}
+		}
+	}
+	sort.Strings(res)
+	return res
+}
+
+func (w *Workspace) check(buildPkg *build.Package) (*types.Package, error) {
+	if pkg, ok := w.Packages[buildPkg.ImportPath]; ok {
+		return pkg.Types, nil
+	}
+	if w.checking[buildPkg.ImportPath] {
+		return nil, errors.New("import cycle through " + buildPkg.ImportPath)
+	}
+	w.checking[buildPkg.ImportPath] = true
+	defer delete(w.checking, buildPkg.ImportPath)
+
+	pkg, err := w.checkFiles(buildPkg, buildPkg.ImportPath,
+		[][]string{buildPkg.GoFiles, buildPkg.CgoFiles}, [][]string{buildPkg.TestGoFiles})
+	if err != nil {
+		return nil, err
+	}
+	w.Packages[buildPkg.ImportPath] = pkg
+	return pkg.Types, nil
+}
+
+func (w *Workspace) checkXTest(buildPkg *build.Package) error {
+	path := buildPkg.ImportPath + "_test"
+	pkg, err := w.checkFiles(buildPkg, path, nil, [][]string{buildPkg.XTestGoFiles})
+	if err != nil {
+		return err
+	}
+	pkg.XTest = true
+	w.Packages[path] = pkg
+	return nil
+}
+
+func (w *Workspace) checkFiles(buildPkg *build.Package, path string, srcLists,
+	testLists [][]string) (*WorkspacePackage, error) {
+	pkg := &WorkspacePackage{
+		Build:     buildPkg,
+		TestFiles: map[*ast.File]bool{},
+		Info: &types.Info{
+			Types:      map[ast.Expr]types.TypeAndValue{},
+			Defs:       map[*ast.Ident]types.Object{},
+			Uses:       map[*ast.Ident]types.Object{},
+			Implicits:  map[ast.Node]types.Object{},
+			Selections: map[*ast.SelectorExpr]*types.Selection{},
+			Instances:  map[*ast.Ident]types.Instance{},
+		},
+	}
+	for i, lists := range [][][]string{srcLists, testLists} {
+		for _, list := range lists {
+			for _, name := range list {
+				file, err := parser.ParseFile(w.Fset, filepath.Join(buildPkg.Dir, name), nil,
+					parser.ParseComments)
+				if err != nil {
+					return nil, err
+				}
+				pkg.Files = append(pkg.Files, file)
+				pkg.TestFiles[file] = i == 1
+			}
+		}
+	}
+
+	var firstErr error
+	conf := types.Config{
+		Importer:    w,
+		FakeImportC: true,
+		Error: func(err error) {
+			if firstErr == nil {
+				firstErr = err
+			}
+		},
+	}
+	pkg.Types, _ = conf.Check(path, w.Fset, pkg.Files, pkg.Info)
+	if firstErr != nil {
+		log.Println("Type checking", path, "proceeding...", firstErr)
+	}
+	return pkg, nil
+}
+
+// stdImporter creates an importer for standard library
+// packages which reads export data produced by the go
+// command for a build configuration.
+// It also returns the given packages along with all of
+// their dependencies.
+func stdImporter(fset *token.FileSet, paths []string, config BuildConfig) (types.Importer, []string, error) {
+	exports := map[string]string{}
+	var deps []string
+	if len(paths) > 0 {
+		env, flags := config.goArgs()
+		args := append([]string{"list", "-export", "-deps", "-f", "{{.ImportPath}}={{.Export}}"}, flags...)
+		args = append(args, paths...)
+		var stdout, stderr bytes.Buffer
+		cmd := exec.Command("go", args...)
+		cmd.Env = append(append(os.Environ(), "GO111MODULE=off", "GOFLAGS="), env...)
+		cmd.Stdout = &stdout
+		cmd.Stderr = &stderr
+		if err := cmd.Run(); err != nil {
+			return nil, nil, fmt.Errorf("go list: %s", strings.TrimSpace(stderr.String()))
+		}
+		scanner := bufio.NewScanner(&stdout)
+		for scanner.Scan() {
+			parts := strings.SplitN(scanner.Text(), "=", 2)
+			if len(parts) == 2 && parts[1] != "" {
+				exports[parts[0]] = parts[1]
+				deps = append(deps, parts[0])
+			}
+		}
+	}
+	return importer.ForCompiler(fset, "gc", func(path string) (io.ReadCloser, error) {
+		if export, ok := exports[path]; ok {
+			return os.Open(export)
+		}
+		return nil, errors.New("no export data for " + path)
+	}), deps, nil
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/unixpickle/gobfuscate/obfuscator"
+)
+
+// A plan is the JSON form of a dry run.
+type plan struct {
+	Moves     []*obfuscator.MappingEntry  `json:"moves"`
+	Renames   []*obfuscator.MappingEntry  `json:"renames"`
+	Linknames []*obfuscator.Linkname      `json:"linknames"`
+	Consts    []*obfuscator.PlannedConst  `json:"consts"`
+	Strings   []*obfuscator.PlannedString `json:"strings"`
+	Skipped   []*obfuscator.Skip          `json:"skipped"`
+
+	SkippedStrings []*obfuscator.PlannedString `json:"skippedStrings"`
+}
+
+func newPlan(res *obfuscator.Result) *plan {
+	p := &plan{
+		Linknames: res.Linknames,
+		Consts:    res.Consts,
+		Strings:   res.Strings,
+		Skipped:   res.Skipped,
+
+		SkippedStrings: res.SkippedStrings,
+	}
+	for _, entry := range res.Mapping.Entries {
+		if entry.Kind == obfuscator.KindPackage {
+			p.Moves = append(p.Moves, entry)
+		} else {
+			p.Renames = append(p.Renames, entry)
+		}
+	}
+	return p
+}
+
+// writePlan prints the result of a dry run in the "text" or
+// "json" format.
+func writePlan(w io.Writer, res *obfuscator.Result, format string) error {
+	p := newPlan(res)
+	switch format {
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(p)
+	case "text":
+		var lines []string
+		section := func(title string, count int) {
+			lines = append(lines, fmt.Sprintf("%s (%d):", title, count))
+		}
+		section("Package moves", len(p.Moves))
+		for _, m := range p.Moves {
+			lines = append(lines, fmt.Sprintf("  %s => %s", m.Original, m.Obfuscated))
+		}
+		section("Renames", len(p.Renames))
+		for _, r := range p.Renames {
+			lines = append(lines, fmt.Sprintf("  %s %s => %s (%s)", r.Kind, r.Original, r.Obfuscated, r.Position))
+		}
+		section("Linknames", len(p.Linknames))
+		for _, l := range p.Linknames {
+			lines = append(lines, fmt.Sprintf("  %s: %s => %s", l.Position, l.Old, l.New))
+		}
+		section("Constant uses", len(p.Consts))
+		for _, c := range p.Consts {
+			lines = append(lines, fmt.Sprintf("  %s: %s = %s", c.Position, strings.Join(c.Names, ", "),
+				strconv.Quote(c.Value)))
+		}
+		section("Strings", len(p.Strings))
+		for _, s := range p.Strings {
+			lines = append(lines, fmt.Sprintf("  %s: %s", s.Position, strconv.Quote(s.Value)))
+		}
+		section("Skipped", len(p.Skipped))
+		for _, s := range p.Skipped {
+			lines = append(lines, fmt.Sprintf("  %s %s (%s): %s", s.Kind, s.Name, s.Position, s.Reason))
+		}
+		section("Skipped strings", len(p.SkippedStrings))
+		for _, s := range p.SkippedStrings {
+			lines = append(lines, fmt.Sprintf("  %s: %s: %s", s.Position, strconv.Quote(s.Value), s.Reason))
+		}
+		_, err := io.WriteString(w, strings.Join(lines, "\n")+"\n")
+		return err
+	}
+	return fmt.Errorf("unknown plan format: %q", format)
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/unixpickle/gobfuscate/obfuscator"
+)
+
+// symbolize runs the symbolize subcommand.
+func symbolize(args []string) bool {
+	flags := flag.NewFlagSet("symbolize", flag.ExitOnError)
+	padding := flags.String("padding", "", "the padding used for the build, to decrypt an encrypted mapping")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: gobfuscate symbolize [flags] mapping_file <input >output")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return false
+	}
+
+	var key []byte
+	if *padding != "" {
+		key = obfuscator.MappingKey(obfuscator.NameHasher(*padding))
+	}
+	mapping, err := obfuscator.ReadMapping(flags.Arg(0), key)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to read mapping:", err)
+		return false
+	}
+	if err := obfuscator.NewSymbolizer(mapping).SymbolizeStream(os.Stdin, os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to symbolize:", err)
+		return false
+	}
+	return true
+}